@@ -115,15 +115,25 @@ func (d *Deserializer) ReadBatch(batchIndex int) (*Batch, error) {
 		ColumnTypes: make([]byte, len(columnFiles)),
 		Data:        make([][]int64, len(columnFiles)),
 		String:      make(map[int]string),
+		Nulls:       make(map[int][]int64),
 	}
 
 	for i, colIdx := range columnFiles {
-		colPath := filepath.Join(d.tablePath, fmt.Sprintf("column_%d.dat", colIdx))
+		colPath := filepath.Join(d.tablePath, ColumnFileName(colIdx))
 		data, columnType, stringData, err := d.readColumnBatch(colPath, batchIndex)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read column %d batch %d: %w", colIdx, batchIndex, err)
 		}
 
+		nullsPath := filepath.Join(d.tablePath, NullsFileName(colIdx))
+		if _, err := os.Stat(nullsPath); err == nil {
+			nulls, _, _, err := d.readColumnBatch(nullsPath, batchIndex)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read nulls of column %d batch %d: %w", colIdx, batchIndex, err)
+			}
+			batch.Nulls[i] = nulls
+		}
+
 		batch.ColumnTypes[i] = columnType
 		batch.Data[i] = data
 
@@ -133,6 +143,10 @@ func (d *Deserializer) ReadBatch(batchIndex int) (*Batch, error) {
 
 		if i == 0 {
 			batch.BatchSize = int32(len(data))
+			if columnType == TypeString {
+				// string columns store BatchSize+1 offsets
+				batch.BatchSize--
+			}
 		}
 	}
 	return batch, nil
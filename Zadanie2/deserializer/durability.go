@@ -0,0 +1,50 @@
+package deserializer
+
+import (
+	"fmt"
+	"os"
+)
+
+// Durability selects when written data is forced to stable storage with
+// fsync, trading load throughput for safety against power loss.
+type Durability string
+
+const (
+	// DurabilityNone never calls fsync. Data survives a crash of the server
+	// but not of the machine.
+	DurabilityNone Durability = "none"
+	// DurabilityBatch syncs every written batch and every published load.
+	DurabilityBatch Durability = "batch"
+	// DurabilityCommit syncs the table files and their directories once per
+	// published load, before the load is committed in the WAL.
+	DurabilityCommit Durability = "commit"
+)
+
+// ParseDurability parses the name of a durability mode; an empty name selects
+// DurabilityCommit.
+func ParseDurability(name string) (Durability, error) {
+	switch d := Durability(name); d {
+	case "":
+		return DurabilityCommit, nil
+	case DurabilityNone, DurabilityBatch, DurabilityCommit:
+		return d, nil
+	default:
+		return "", fmt.Errorf("unknown durability mode '%s', expected none, batch or commit", name)
+	}
+}
+
+// syncsCommits reports whether published loads are synced.
+func (d Durability) syncsCommits() bool {
+	return d != DurabilityNone
+}
+
+// SyncDir syncs a directory, making the creation, removal and renaming of
+// files in it durable.
+func SyncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
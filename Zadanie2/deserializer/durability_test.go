@@ -0,0 +1,27 @@
+package deserializer
+
+import "testing"
+
+func TestParseDurability(t *testing.T) {
+	tests := []struct {
+		name string
+		want Durability
+	}{
+		{"", DurabilityCommit},
+		{"none", DurabilityNone},
+		{"batch", DurabilityBatch},
+		{"commit", DurabilityCommit},
+	}
+	for _, test := range tests {
+		got, err := ParseDurability(test.name)
+		if err != nil || got != test.want {
+			t.Errorf("ParseDurability(%q) = %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+
+	for _, name := range []string{"fsync", "Commit"} {
+		if _, err := ParseDurability(name); err == nil {
+			t.Errorf("ParseDurability(%q) accepted an unknown mode", name)
+		}
+	}
+}
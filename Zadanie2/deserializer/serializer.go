@@ -33,6 +33,7 @@ type Serializer struct {
 	tablePath  string
 	numRows    int32
 	numColumns int32
+	durability Durability
 }
 
 type Batch struct {
@@ -41,6 +42,7 @@ type Batch struct {
 	ColumnTypes []byte
 	Data        [][]int64
 	String      map[int]string
+	Nulls       map[int][]int64 // Row indices holding NULL; present for every nullable column
 }
 
 func NewSerializer(tablePath string, numRows int32, numColumns int32) (*Serializer, error) {
@@ -56,19 +58,46 @@ func NewSerializer(tablePath string, numRows int32, numColumns int32) (*Serializ
 	}, nil
 }
 
+// SetDurability sets the durability mode; with DurabilityBatch every file
+// is synced after a batch is appended to it.
+func (s *Serializer) SetDurability(durability Durability) {
+	s.durability = durability
+}
+
+func ColumnFileName(colIdx int) string {
+	return fmt.Sprintf("column_%d.dat", colIdx)
+}
+
+// NullsFileName is the file storing NULL positions of a nullable column. It
+// has the column file format: every batch is an int column of row indices.
+func NullsFileName(colIdx int) string {
+	return fmt.Sprintf("nulls_%d.dat", colIdx)
+}
+
 func (s *Serializer) WriteBatch(batchIndex int, batch *Batch) error {
 	// log.Println("Writing batch1:", batch)
 	for colIdx := int32(0); colIdx < batch.NumColumns; colIdx++ {
 		if err := s.writeColumnBatch(colIdx, batchIndex, batch); err != nil {
 			return fmt.Errorf("failed to write column %d: %w", colIdx, err)
 		}
+		if nulls, ok := batch.Nulls[int(colIdx)]; ok {
+			nullsFile := filepath.Join(s.tablePath, NullsFileName(int(colIdx)))
+			if err := s.appendColumnFile(nullsFile, TypeInt, nulls, ""); err != nil {
+				return fmt.Errorf("failed to write nulls of column %d: %w", colIdx, err)
+			}
+		}
 	}
 	return nil
 }
 
 func (s *Serializer) writeColumnBatch(colIdx int32, batchIndex int, batch *Batch) error {
-	columnFile := filepath.Join(s.tablePath, fmt.Sprintf("column_%d.dat", colIdx))
+	columnFile := filepath.Join(s.tablePath, ColumnFileName(int(colIdx)))
+	return s.appendColumnFile(columnFile, batch.ColumnTypes[colIdx], batch.Data[colIdx], batch.String[int(colIdx)])
+}
 
+// appendColumnFile appends one batch of values (and strings for string
+// columns) to a column file, creating the file if needed.
+func (s *Serializer) appendColumnFile(columnFile string, columnType byte, values []int64, stringData string) error {
 	// log.Println("Writing batch2:", batch)
 	// Check if file exists
 	fileExists := false
@@ -106,7 +135,7 @@ func (s *Serializer) writeColumnBatch(colIdx int32, batchIndex int, batch *Batch
 		defer file.Close()
 
 		header = ColumnFileHeader{
-			ColumnType:   batch.ColumnTypes[colIdx],
+			ColumnType:   columnType,
 			NumBatches:   0,
 			FooterOffset: HeaderSize,
 		}
@@ -117,8 +146,8 @@ func (s *Serializer) writeColumnBatch(colIdx int32, batchIndex int, batch *Batch
 		}
 	}
 
-	row := make([]int64, len(batch.Data[colIdx]))
-	copy(row, batch.Data[colIdx])
+	row := make([]int64, len(values))
+	copy(row, values)
 
 	compressed, minValue := utils.CompressIntegers(row)
 
@@ -134,8 +163,8 @@ func (s *Serializer) writeColumnBatch(colIdx int32, batchIndex int, batch *Batch
 	currentOffset += int64(n)
 
 	var stringSize int64 = 0
-	if batch.ColumnTypes[colIdx] == TypeString {
-		compressedString, err := utils.CompressLZ4([]byte(batch.String[int(colIdx)]))
+	if columnType == TypeString {
+		compressedString, err := utils.CompressLZ4([]byte(stringData))
 		if err != nil {
 			return err
 		}
@@ -169,6 +198,9 @@ func (s *Serializer) writeColumnBatch(colIdx int32, batchIndex int, batch *Batch
 		return err
 	}
 
+	if s.durability == DurabilityBatch {
+		return file.Sync()
+	}
 	return nil
 }
 
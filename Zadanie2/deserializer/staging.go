@@ -0,0 +1,430 @@
+package deserializer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// StagingDir holds the staging directories of all loads in progress.
+func StagingDir(dataDir string) string {
+	return filepath.Join(dataDir, ".staging")
+}
+
+// StagingPath is the directory the batches of a load are written to before
+// they are published to the table. It lives outside of the table directory,
+// so readers of the table never see staged files.
+func StagingPath(dataDir, id string) string {
+	return filepath.Join(StagingDir(dataDir), id)
+}
+
+// fileUndo holds what is needed to restore a column file modified while
+// publishing. Appending overwrites only the header and everything from the
+// old footer on, so those bytes and the old size are enough.
+type fileUndo struct {
+	path    string
+	existed bool
+	size    int64
+	header  []byte
+	tail    []byte // bytes from the old footer offset to the end of the file
+	offset  int64  // old footer offset
+}
+
+// PublishStaged appends all batches staged in stagedPath to the files of
+// tablePath and removes the staging directory. Staged files are column files
+// written by a Serializer, so their batches are copied as they are and only
+// the footers are merged. The previous contents of the table files are logged
+// in wal first; if publishing fails, or the server crashes before it is
+// committed, every table file is restored from it. Unless the durability mode
+// of wal is DurabilityNone, the table files and directory are synced before
+// the commit.
+func PublishStaged(wal *WAL, tablePath, stagedPath string) error {
+	return PublishInserts(wal, tablePath, stagedPath, nil)
+}
+
+// PublishInserts publishes staged batches like PublishStaged. The batches hold
+// the rows of the insert records in flushed, which are marked as written to
+// the table files by the same commit.
+func PublishInserts(wal *WAL, tablePath, stagedPath string, flushed []int64) error {
+	return publish(wal, tablePath, stagedPath, flushed, nil)
+}
+
+// PublishWithState publishes staged batches like PublishStaged and replaces
+// the contents of the file statePath with state as part of the same
+// publication, e.g. to record up to which offset a source file has been
+// loaded. If the publication is rolled back, the previous contents of
+// statePath are restored with the table files.
+func PublishWithState(wal *WAL, tablePath, stagedPath, statePath string, state []byte) error {
+	old, err := os.ReadFile(statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return publish(wal, tablePath, stagedPath, nil, &stateUndo{path: statePath, existed: err == nil, old: old, data: state})
+}
+
+// stateUndo holds the previous and the new contents of the state file of a
+// publication.
+type stateUndo struct {
+	path    string
+	existed bool
+	old     []byte
+	data    []byte
+}
+
+func publish(wal *WAL, tablePath, stagedPath string, flushed []int64, state *stateUndo) error {
+	entries, err := os.ReadDir(stagedPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tablePath, 0755); err != nil {
+		return err
+	}
+
+	var names []string
+	var undos []fileUndo
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		undo, err := saveUndo(filepath.Join(tablePath, entry.Name()))
+		if err != nil {
+			return err
+		}
+		names = append(names, entry.Name())
+		undos = append(undos, undo)
+	}
+
+	sync := wal.durability.syncsCommits()
+	if len(names) == 0 {
+		if err := wal.DiscardInserts(flushed); err != nil {
+			return fmt.Errorf("failed to log load: %w", err)
+		}
+		if state != nil {
+			// there is nothing to roll back together with the state
+			if err := WriteState(state.path, state.data, sync); err != nil {
+				return err
+			}
+		}
+		return os.RemoveAll(stagedPath)
+	}
+
+	rec := undoRecord(filepath.Base(tablePath), undos)
+	if state != nil {
+		rec.State = &walStateUndo{Path: state.path, Existed: state.existed, Data: state.old}
+	}
+	id, err := wal.begin(rec)
+	if err != nil {
+		return fmt.Errorf("failed to log load: %w", err)
+	}
+
+	// restore undoes the publication; it is committed if nothing is left to
+	// roll back
+	restore := func(undos []fileUndo) {
+		err := restoreFiles(undos, sync)
+		if state != nil {
+			if stateErr := restoreState(state.path, state.existed, state.old, sync); err == nil {
+				err = stateErr
+			}
+		}
+		if err == nil {
+			wal.commit(id, nil)
+		}
+	}
+
+	for i, name := range names {
+		if err := appendStagedFile(undos[i].path, filepath.Join(stagedPath, name), sync); err != nil {
+			restore(undos[:i+1])
+			return fmt.Errorf("failed to publish %s: %w", name, err)
+		}
+	}
+
+	if sync {
+		// new column files have to be found after a power loss
+		if err := SyncDir(tablePath); err != nil {
+			restore(undos)
+			return fmt.Errorf("failed to sync %s: %w", tablePath, err)
+		}
+	}
+
+	if state != nil {
+		if err := WriteState(state.path, state.data, sync); err != nil {
+			restore(undos)
+			return fmt.Errorf("failed to write %s: %w", state.path, err)
+		}
+	}
+
+	if err := wal.commit(id, flushed); err != nil {
+		// the rows must not stay visible when the load is reported failed
+		restore(undos)
+		return fmt.Errorf("failed to log load: %w", err)
+	}
+	return os.RemoveAll(stagedPath)
+}
+
+func saveUndo(path string) (fileUndo, error) {
+	undo := fileUndo{path: path}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return undo, nil
+	}
+	if err != nil {
+		return undo, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return undo, err
+	}
+	var s Serializer
+	header, err := s.readColumnHeader(file)
+	if err != nil {
+		return undo, fmt.Errorf("failed to read header of %s: %w", path, err)
+	}
+
+	undo.existed = true
+	undo.size = info.Size()
+	undo.offset = header.FooterOffset
+	undo.header = make([]byte, HeaderSize)
+	if _, err := file.ReadAt(undo.header, 0); err != nil {
+		return undo, err
+	}
+	undo.tail = make([]byte, undo.size-undo.offset)
+	if _, err := file.ReadAt(undo.tail, undo.offset); err != nil && err != io.EOF {
+		return undo, err
+	}
+	return undo, nil
+}
+
+// restoreFiles undoes the changes made to files while publishing, newest
+// first, syncing the restored files if sync is set. Files of a table dropped
+// in the meantime are skipped. The first error is returned after trying to
+// restore all the other files.
+func restoreFiles(undos []fileUndo, sync bool) error {
+	var firstErr error
+	fail := func(err error) {
+		if err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for i := len(undos) - 1; i >= 0; i-- {
+		undo := undos[i]
+		if !undo.existed {
+			fail(os.Remove(undo.path))
+			continue
+		}
+		file, err := os.OpenFile(undo.path, os.O_RDWR, 0644)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		_, err = file.WriteAt(undo.tail, undo.offset)
+		fail(err)
+		_, err = file.WriteAt(undo.header, 0)
+		fail(err)
+		fail(file.Truncate(undo.size))
+		if sync {
+			fail(file.Sync())
+		}
+		fail(file.Close())
+	}
+	return firstErr
+}
+
+// appendStagedFile appends the batches of the column file src to dst,
+// creating dst if it does not exist yet, and syncs dst if sync is set.
+func appendStagedFile(dst, src string, sync bool) error {
+	var s Serializer
+
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	srcHeader, err := s.readColumnHeader(srcFile)
+	if err != nil {
+		return err
+	}
+	srcFooter, err := s.readColumnFooter(srcFile, &srcHeader)
+	if err != nil {
+		return err
+	}
+
+	dstFile, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	info, err := dstFile.Stat()
+	if err != nil {
+		return err
+	}
+	header := ColumnFileHeader{ColumnType: srcHeader.ColumnType, FooterOffset: HeaderSize}
+	footer := ColumnFooter{BatchOffsets: []int64{HeaderSize}}
+	if info.Size() > 0 {
+		if header, err = s.readColumnHeader(dstFile); err != nil {
+			return err
+		}
+		if footer, err = s.readColumnFooter(dstFile, &header); err != nil {
+			return err
+		}
+	}
+
+	// the staged batches are copied right after the batches of dst
+	shift := header.FooterOffset - HeaderSize
+	if _, err := dstFile.Seek(header.FooterOffset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := srcFile.Seek(HeaderSize, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(dstFile, srcFile, srcHeader.FooterOffset-HeaderSize); err != nil {
+		return err
+	}
+
+	for _, offset := range srcFooter.BatchOffsets[1:] {
+		footer.BatchOffsets = append(footer.BatchOffsets, offset+shift)
+	}
+	footer.BatchDeltas = append(footer.BatchDeltas, srcFooter.BatchDeltas...)
+	footer.StringSizes = append(footer.StringSizes, srcFooter.StringSizes...)
+	header.NumBatches += srcHeader.NumBatches
+	header.FooterOffset += srcHeader.FooterOffset - HeaderSize
+
+	if err := s.writeColumnFooter(dstFile, &header, &footer); err != nil {
+		return err
+	}
+	if err := s.writeColumnHeader(dstFile, &header); err != nil {
+		return err
+	}
+	if sync {
+		return dstFile.Sync()
+	}
+	return nil
+}
+
+// ReplaceTable replaces the directory tablePath with newPath, a directory of
+// column files written by a Serializer. The old directory is moved to
+// backupPath and removed once the replacement is committed in wal; after a
+// crash before the commit it is moved back.
+func ReplaceTable(wal *WAL, tablePath, newPath, backupPath string) error {
+	sync := wal.durability.syncsCommits()
+	if sync {
+		if err := syncFiles(newPath); err != nil {
+			return err
+		}
+	}
+
+	id, err := wal.begin(walRecord{Table: filepath.Base(tablePath), Path: tablePath, Backup: backupPath})
+	if err != nil {
+		return fmt.Errorf("failed to log load: %w", err)
+	}
+
+	err = os.Rename(tablePath, backupPath)
+	if err == nil {
+		err = os.Rename(newPath, tablePath)
+	}
+	if err == nil && sync {
+		err = SyncDir(filepath.Dir(tablePath))
+	}
+	if err != nil {
+		if restoreTable(tablePath, backupPath, sync) == nil {
+			wal.commit(id, nil)
+		}
+		return fmt.Errorf("failed to replace %s: %w", tablePath, err)
+	}
+
+	if err := wal.commit(id, nil); err != nil {
+		// like a publication, the failed merge must not stay visible
+		if restoreTable(tablePath, backupPath, sync) == nil {
+			wal.commit(id, nil)
+		}
+		return fmt.Errorf("failed to log load: %w", err)
+	}
+	return os.RemoveAll(backupPath)
+}
+
+// restoreTable moves the table directory saved at backupPath back to
+// tablePath. Nothing is done if the directory was not moved yet.
+func restoreTable(tablePath, backupPath string, sync bool) error {
+	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.RemoveAll(tablePath); err != nil {
+		return err
+	}
+	if err := os.Rename(backupPath, tablePath); err != nil {
+		return err
+	}
+	if sync {
+		return SyncDir(filepath.Dir(tablePath))
+	}
+	return nil
+}
+
+// syncFiles syncs all files of a directory and the directory itself.
+func syncFiles(path string) error {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		file, err := os.Open(filepath.Join(path, entry.Name()))
+		if err != nil {
+			return err
+		}
+		err = file.Sync()
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return SyncDir(path)
+}
+
+// WriteState replaces the contents of a state file. The data is written to a
+// temporary file first, so the state file is always complete; it is synced
+// if sync is set.
+func WriteState(path string, data []byte, sync bool) error {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil && sync {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if sync {
+		return SyncDir(filepath.Dir(path))
+	}
+	return nil
+}
+
+// restoreState puts back the previous contents of a state file, removing it
+// if it did not exist.
+func restoreState(path string, existed bool, old []byte, sync bool) error {
+	if !existed {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return WriteState(path, old, sync)
+}
@@ -0,0 +1,239 @@
+package deserializer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeBatches writes one batch per element of batches, each holding the
+// given rows of int columns, to the column files of path.
+func writeBatches(t *testing.T, path string, batches ...[][]int64) {
+	t.Helper()
+	s, err := NewSerializer(path, BatchSize, int32(len(batches[0])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, columns := range batches {
+		batch := &Batch{
+			BatchSize:   int32(len(columns[0])),
+			NumColumns:  int32(len(columns)),
+			ColumnTypes: make([]byte, len(columns)),
+			Data:        columns,
+			String:      map[int]string{},
+		}
+		if err := s.WriteBatch(i, batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readTable(t *testing.T, path string) [][]int64 {
+	t.Helper()
+	d, _ := NewBatchDeserializer(path)
+	data, _, err := d.ReadTableData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func openTestWAL(t *testing.T, dataDir string) (*WAL, []PendingInsert) {
+	t.Helper()
+	wal, pending, err := OpenWAL(dataDir, DurabilityNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { wal.Close() })
+	return wal, pending
+}
+
+func walSize(t *testing.T, dataDir string) int64 {
+	t.Helper()
+	info, err := os.Stat(filepath.Join(dataDir, WALFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestPublishStagedAppendsBatches(t *testing.T) {
+	dataDir := t.TempDir()
+	tablePath := filepath.Join(dataDir, "t")
+	stagedPath := StagingPath(dataDir, "load")
+	wal, _ := openTestWAL(t, dataDir)
+
+	writeBatches(t, tablePath, [][]int64{{1, 2}, {10, 20}})
+	writeBatches(t, stagedPath, [][]int64{{3}, {30}}, [][]int64{{4, 5}, {40, 50}})
+
+	if err := PublishStaged(wal, tablePath, stagedPath); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]int64{{1, 2, 3, 4, 5}, {10, 20, 30, 40, 50}}
+	if got := readTable(t, tablePath); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+	if _, err := os.Stat(stagedPath); !os.IsNotExist(err) {
+		t.Errorf("staging directory not removed: %v", err)
+	}
+	if size := walSize(t, dataDir); size != 0 {
+		t.Errorf("log holds %d bytes after the commit, want it truncated", size)
+	}
+}
+
+func TestPublishStagedCreatesTableFiles(t *testing.T) {
+	dataDir := t.TempDir()
+	tablePath := filepath.Join(dataDir, "t")
+	stagedPath := StagingPath(dataDir, "load")
+	wal, _ := openTestWAL(t, dataDir)
+
+	writeBatches(t, stagedPath, [][]int64{{7, 8}})
+
+	if err := PublishStaged(wal, tablePath, stagedPath); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]int64{{7, 8}}
+	if got := readTable(t, tablePath); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+}
+
+func TestPublishStagedRollsBackOnError(t *testing.T) {
+	dataDir := t.TempDir()
+	tablePath := filepath.Join(dataDir, "t")
+	stagedPath := StagingPath(dataDir, "load")
+	wal, _ := openTestWAL(t, dataDir)
+
+	writeBatches(t, tablePath, [][]int64{{1, 2}, {10, 20}})
+	writeBatches(t, stagedPath, [][]int64{{3}, {30}})
+	// column_0.dat is appended before the broken column_1.dat is read
+	if err := os.WriteFile(filepath.Join(stagedPath, ColumnFileName(1)), []byte("broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before := readFiles(t, tablePath)
+
+	if err := PublishStaged(wal, tablePath, stagedPath); err == nil {
+		t.Fatal("publishing a broken staged file succeeded")
+	}
+
+	if after := readFiles(t, tablePath); !reflect.DeepEqual(after, before) {
+		t.Error("table files were not restored")
+	}
+	if size := walSize(t, dataDir); size != 0 {
+		t.Errorf("log holds %d bytes after the rollback, want it truncated", size)
+	}
+}
+
+func TestPublishWithStateRollsBackState(t *testing.T) {
+	dataDir := t.TempDir()
+	tablePath := filepath.Join(dataDir, "t")
+	stagedPath := StagingPath(dataDir, "load")
+	statePath := filepath.Join(dataDir, "state.json")
+	wal, _ := openTestWAL(t, dataDir)
+
+	writeBatches(t, tablePath, [][]int64{{1}})
+	writeBatches(t, stagedPath, [][]int64{{2}})
+	if err := os.WriteFile(statePath, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := PublishWithState(wal, tablePath, stagedPath, statePath, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(statePath); string(data) != "new" {
+		t.Errorf("state holds %q, want %q", data, "new")
+	}
+
+	// the state is written last, so a state file which cannot be written
+	// rolls back the table files already appended to
+	writeBatches(t, stagedPath, [][]int64{{3}})
+	before := readFiles(t, tablePath)
+	badState := filepath.Join(dataDir, "missing", "state.json")
+	if err := PublishWithState(wal, tablePath, stagedPath, badState, []byte("new")); err == nil {
+		t.Fatal("publishing with an unwritable state file succeeded")
+	}
+	if after := readFiles(t, tablePath); !reflect.DeepEqual(after, before) {
+		t.Error("table files were not restored")
+	}
+	if _, err := os.Stat(badState); !os.IsNotExist(err) {
+		t.Errorf("state file left behind: %v", err)
+	}
+}
+
+// readFiles returns the contents of all files in dir by name.
+func readFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[entry.Name()] = string(data)
+	}
+	return files
+}
+
+func TestReplaceTable(t *testing.T) {
+	dataDir := t.TempDir()
+	tablePath := filepath.Join(dataDir, "t")
+	newPath := StagingPath(dataDir, "merge")
+	backupPath := StagingPath(dataDir, "merge.old")
+	wal, _ := openTestWAL(t, dataDir)
+
+	writeBatches(t, tablePath, [][]int64{{1, 2}, {10, 20}})
+	writeBatches(t, newPath, [][]int64{{2, 3}, {21, 30}})
+	if err := ReplaceTable(wal, tablePath, newPath, backupPath); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]int64{{2, 3}, {21, 30}}
+	if got := readTable(t, tablePath); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+	for _, path := range []string{newPath, backupPath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s left behind: %v", path, err)
+		}
+	}
+	if size := walSize(t, dataDir); size != 0 {
+		t.Errorf("log holds %d bytes after the commit, want it truncated", size)
+	}
+}
+
+func TestReplayRestoresReplacedTable(t *testing.T) {
+	dataDir := t.TempDir()
+	tablePath := filepath.Join(dataDir, "t")
+	newPath := StagingPath(dataDir, "merge")
+	backupPath := StagingPath(dataDir, "merge.old")
+	wal, _ := openTestWAL(t, dataDir)
+
+	writeBatches(t, tablePath, [][]int64{{1}})
+	writeBatches(t, newPath, [][]int64{{2}})
+	before := readFiles(t, tablePath)
+
+	// the directories are swapped, but the server crashes before the commit
+	if _, err := wal.begin(walRecord{Table: "t", Path: tablePath, Backup: backupPath}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tablePath, backupPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(newPath, tablePath); err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+
+	openTestWAL(t, dataDir)
+	if after := readFiles(t, tablePath); !reflect.DeepEqual(after, before) {
+		t.Error("table directory was not restored by the replay")
+	}
+	if _, err := os.Stat(backupPath); !os.IsNotExist(err) {
+		t.Errorf("backup left behind: %v", err)
+	}
+}
@@ -0,0 +1,342 @@
+package deserializer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// WALFileName is the write-ahead log kept in the data directory.
+const WALFileName = "wal.log"
+
+// walRecord is one line of the write-ahead log. A "begin" record is written
+// before a load is published and holds the undo information of every file
+// the publication modifies, or, when the whole table directory Path is
+// replaced, the Backup path the old directory is moved to; a "commit" record
+// with the same ID marks the publication as complete and lists the Flushed
+// insert records whose rows it wrote to the table files. An "insert" record
+// holds rows buffered in memory for a table, a "discard" record lists insert
+// records whose rows are no longer needed. A begin record may also hold the
+// previous contents of a State file replaced by the publication.
+type walRecord struct {
+	ID      int64           `json:"id"`
+	Type    string          `json:"type"`
+	Table   string          `json:"table,omitempty"`
+	Files   []walFileUndo   `json:"files,omitempty"`
+	Path    string          `json:"path,omitempty"`
+	Backup  string          `json:"backup,omitempty"`
+	State   *walStateUndo   `json:"state,omitempty"`
+	Rows    json.RawMessage `json:"rows,omitempty"`
+	Flushed []int64         `json:"flushed,omitempty"`
+}
+
+const (
+	walBegin   = "begin"
+	walCommit  = "commit"
+	walInsert  = "insert"
+	walDiscard = "discard"
+)
+
+type walFileUndo struct {
+	Path    string `json:"path"`
+	Existed bool   `json:"existed"`
+	Size    int64  `json:"size"`
+	Offset  int64  `json:"offset"`
+	Header  []byte `json:"header,omitempty"`
+	Tail    []byte `json:"tail,omitempty"`
+}
+
+type walStateUndo struct {
+	Path    string `json:"path"`
+	Existed bool   `json:"existed"`
+	Data    []byte `json:"data,omitempty"`
+}
+
+// PendingInsert holds the rows of an insert record which were not written to
+// the table files before the server stopped.
+type PendingInsert struct {
+	ID    int64
+	Table string
+	Rows  json.RawMessage
+}
+
+// WAL is an undo log making publication of staged loads atomic across all
+// files of a table. Publications which began but did not commit before a
+// crash are rolled back by OpenWAL. It also keeps the rows of small inserts
+// until they are flushed to the table files. Records are appended only while
+// a publication is in progress or inserted rows are unflushed; the log is
+// truncated whenever neither is the case.
+type WAL struct {
+	mu         sync.Mutex
+	file       *os.File
+	size       int64
+	nextID     int64
+	active     int
+	unflushed  map[int64]bool
+	durability Durability
+}
+
+// OpenWAL rolls back the publications left uncommitted in the write-ahead log
+// of dataDir and opens the log for appending. Inserted rows which were never
+// flushed are logged again and returned, in the order they were inserted.
+// Records are synced unless durability is DurabilityNone.
+func OpenWAL(dataDir string, durability Durability) (*WAL, []PendingInsert, error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, nil, err
+	}
+	path := filepath.Join(dataDir, WALFileName)
+
+	pending, err := replayWAL(path, durability.syncsCommits())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to replay %s: %w", path, err)
+	}
+
+	w := &WAL{nextID: 1, unflushed: map[int64]bool{}, durability: durability}
+
+	// the pending rows are the only records the new log starts with; it is
+	// written aside, so that a crash meanwhile leaves the old one in place
+	tmpPath := path + ".tmp"
+	w.file, err = os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range pending {
+		pending[i].ID = w.nextID
+		rec := walRecord{ID: w.nextID, Type: walInsert, Table: pending[i].Table, Rows: pending[i].Rows}
+		if err := w.append(rec); err != nil {
+			w.file.Close()
+			return nil, nil, err
+		}
+		w.unflushed[w.nextID] = true
+		w.nextID++
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		w.file.Close()
+		return nil, nil, err
+	}
+	if durability.syncsCommits() {
+		if err := SyncDir(dataDir); err != nil {
+			w.file.Close()
+			return nil, nil, err
+		}
+	}
+	return w, pending, nil
+}
+
+// replayWAL restores the files of every publication without a commit record,
+// newest first, and returns the insert records neither flushed by a committed
+// publication nor discarded. A torn last line is a record whose write did not
+// complete, so none of the files of a begin record were modified yet and the
+// rows of an insert record were not acknowledged.
+func replayWAL(path string, sync bool) ([]PendingInsert, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var begun []walRecord
+	var inserted []walRecord
+	committed := map[int64]bool{}
+	flushed := map[int64]bool{}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var rec walRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			break
+		}
+		switch rec.Type {
+		case walBegin:
+			begun = append(begun, rec)
+		case walCommit:
+			committed[rec.ID] = true
+			for _, id := range rec.Flushed {
+				flushed[id] = true
+			}
+		case walInsert:
+			inserted = append(inserted, rec)
+		case walDiscard:
+			for _, id := range rec.Flushed {
+				flushed[id] = true
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := len(begun) - 1; i >= 0; i-- {
+		if committed[begun[i].ID] {
+			continue
+		}
+		rec := begun[i]
+		if rec.Backup != "" {
+			err = restoreTable(rec.Path, rec.Backup, sync)
+		} else {
+			undos := make([]fileUndo, len(rec.Files))
+			for j, f := range rec.Files {
+				undos[j] = fileUndo{path: f.Path, existed: f.Existed, size: f.Size, offset: f.Offset, header: f.Header, tail: f.Tail}
+			}
+			err = restoreFiles(undos, sync)
+			if err == nil && rec.State != nil {
+				err = restoreState(rec.State.Path, rec.State.Existed, rec.State.Data, sync)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to roll back load into %s: %w", rec.Table, err)
+		}
+	}
+
+	var pending []PendingInsert
+	for _, rec := range inserted {
+		if !flushed[rec.ID] {
+			pending = append(pending, PendingInsert{ID: rec.ID, Table: rec.Table, Rows: rec.Rows})
+		}
+	}
+	return pending, nil
+}
+
+// undoRecord is the begin record of a publication appending to the files
+// described by undos.
+func undoRecord(table string, undos []fileUndo) walRecord {
+	rec := walRecord{Table: table}
+	for _, undo := range undos {
+		rec.Files = append(rec.Files, walFileUndo{
+			Path:    undo.path,
+			Existed: undo.existed,
+			Size:    undo.size,
+			Offset:  undo.offset,
+			Header:  undo.header,
+			Tail:    undo.tail,
+		})
+	}
+	return rec
+}
+
+// begin logs the undo information of a publication and returns its ID. The
+// record is synced before any of the files is modified.
+func (w *WAL) begin(rec walRecord) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	rec.ID = w.nextID
+	rec.Type = walBegin
+	if err := w.append(rec); err != nil {
+		return 0, err
+	}
+	w.nextID++
+	w.active++
+	return rec.ID, nil
+}
+
+// commit marks the publication id as complete and the insert records in
+// flushed as written to the table files. A rolled back publication is
+// committed as well, with no flushed inserts, since its files have already
+// been restored. A publication whose commit could not be logged stays open,
+// so that replay rolls it back.
+func (w *WAL) commit(id int64, flushed []int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.active--
+	if err := w.release(walRecord{ID: id, Type: walCommit, Flushed: flushed}); err != nil {
+		w.active++
+		return err
+	}
+	return nil
+}
+
+// LogInsert logs rows inserted into table and returns the ID of the record.
+// The rows have to be logged again until a publication flushing them is
+// committed, or until they are discarded.
+func (w *WAL) LogInsert(table string, rows json.RawMessage) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	rec := walRecord{ID: w.nextID, Type: walInsert, Table: table, Rows: rows}
+	if err := w.append(rec); err != nil {
+		return 0, err
+	}
+	w.nextID++
+	w.unflushed[rec.ID] = true
+	return rec.ID, nil
+}
+
+// DiscardInserts marks insert records whose rows will not be flushed, e.g.
+// because their table was dropped.
+func (w *WAL) DiscardInserts(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.release(walRecord{Type: walDiscard, Flushed: ids})
+}
+
+// release logs rec, which ends a publication or the insert records in its
+// Flushed list, or truncates the log if nothing would be left to replay.
+func (w *WAL) release(rec walRecord) error {
+	remaining := len(w.unflushed)
+	for _, id := range rec.Flushed {
+		if w.unflushed[id] {
+			remaining--
+		}
+	}
+	if w.active == 0 && remaining == 0 && w.file.Truncate(0) == nil && w.sync() == nil {
+		// nothing left to roll back or to flush
+		w.size = 0
+	} else if err := w.append(rec); err != nil {
+		return err
+	}
+	for _, id := range rec.Flushed {
+		delete(w.unflushed, id)
+	}
+	return nil
+}
+
+// append writes a record at the end of the log and syncs it. A record which
+// could not be written completely is cut off again, so that replay does not
+// stop at it.
+func (w *WAL) append(rec walRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := w.file.WriteAt(line, w.size); err != nil {
+		w.file.Truncate(w.size)
+		return err
+	}
+	if err := w.sync(); err != nil {
+		w.file.Truncate(w.size)
+		return err
+	}
+	w.size += int64(len(line))
+	return nil
+}
+
+func (w *WAL) sync() error {
+	if !w.durability.syncsCommits() {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+// Durability returns the durability mode of the log.
+func (w *WAL) Durability() Durability {
+	return w.durability
+}
+
+// Close closes the log file.
+func (w *WAL) Close() error {
+	return w.file.Close()
+}
@@ -0,0 +1,158 @@
+package deserializer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// beginAppend starts a publication of stagedPath to tablePath and appends
+// the staged files without committing it, like a server crashing before the
+// commit record is written.
+func beginAppend(t *testing.T, wal *WAL, tablePath, stagedPath string) {
+	t.Helper()
+	entries, err := os.ReadDir(stagedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var undos []fileUndo
+	for _, entry := range entries {
+		undo, err := saveUndo(filepath.Join(tablePath, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		undos = append(undos, undo)
+	}
+	if _, err := wal.begin(undoRecord(filepath.Base(tablePath), undos)); err != nil {
+		t.Fatal(err)
+	}
+	for i, entry := range entries {
+		if err := appendStagedFile(undos[i].path, filepath.Join(stagedPath, entry.Name()), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReplayRollsBackUncommittedPublication(t *testing.T) {
+	dataDir := t.TempDir()
+	tablePath := filepath.Join(dataDir, "t")
+	stagedPath := StagingPath(dataDir, "load")
+	wal, _ := openTestWAL(t, dataDir)
+
+	writeBatches(t, tablePath, [][]int64{{1, 2}, {10, 20}})
+	writeBatches(t, stagedPath, [][]int64{{3}, {30}})
+	before := readFiles(t, tablePath)
+
+	beginAppend(t, wal, tablePath, stagedPath)
+	want := [][]int64{{1, 2, 3}, {10, 20, 30}}
+	if got := readTable(t, tablePath); !reflect.DeepEqual(got, want) {
+		t.Fatalf("table holds %v before the replay, want %v", got, want)
+	}
+	wal.Close()
+
+	openTestWAL(t, dataDir)
+	if after := readFiles(t, tablePath); !reflect.DeepEqual(after, before) {
+		t.Error("table files were not restored by the replay")
+	}
+	if size := walSize(t, dataDir); size != 0 {
+		t.Errorf("log holds %d bytes after the replay, want it empty", size)
+	}
+}
+
+func TestReplayKeepsCommittedPublication(t *testing.T) {
+	dataDir := t.TempDir()
+	tablePath := filepath.Join(dataDir, "t")
+	stagedPath := StagingPath(dataDir, "load")
+	wal, _ := openTestWAL(t, dataDir)
+
+	writeBatches(t, tablePath, [][]int64{{1}})
+	// an insert keeps the log from being truncated by the commit
+	if _, err := wal.LogInsert("t", json.RawMessage(`[[9]]`)); err != nil {
+		t.Fatal(err)
+	}
+	writeBatches(t, stagedPath, [][]int64{{2}})
+	if err := PublishStaged(wal, tablePath, stagedPath); err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+
+	openTestWAL(t, dataDir)
+	want := [][]int64{{1, 2}}
+	if got := readTable(t, tablePath); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v after the replay, want %v", got, want)
+	}
+}
+
+func TestReplayReturnsPendingInserts(t *testing.T) {
+	dataDir := t.TempDir()
+	tablePath := filepath.Join(dataDir, "t")
+	stagedPath := StagingPath(dataDir, "load")
+	wal, _ := openTestWAL(t, dataDir)
+
+	var ids []int64
+	for _, rows := range []string{`[[1]]`, `[[2]]`, `[[3]]`, `[[4]]`} {
+		id, err := wal.LogInsert("t", json.RawMessage(rows))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if err := wal.DiscardInserts(ids[:1]); err != nil {
+		t.Fatal(err)
+	}
+	writeBatches(t, stagedPath, [][]int64{{2}})
+	if err := PublishInserts(wal, tablePath, stagedPath, ids[1:2]); err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+
+	wal, pending := openTestWAL(t, dataDir)
+	want := []PendingInsert{
+		{ID: 1, Table: "t", Rows: json.RawMessage(`[[3]]`)},
+		{ID: 2, Table: "t", Rows: json.RawMessage(`[[4]]`)},
+	}
+	if !reflect.DeepEqual(pending, want) {
+		t.Fatalf("pending inserts are %+v, want %+v", pending, want)
+	}
+
+	// the pending inserts are logged again, so they survive another restart
+	// until they are flushed
+	if err := wal.DiscardInserts([]int64{pending[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+	wal, pending = openTestWAL(t, dataDir)
+	if len(pending) != 1 || string(pending[0].Rows) != `[[4]]` {
+		t.Fatalf("pending inserts are %+v after the second restart, want only [[4]]", pending)
+	}
+
+	if err := wal.DiscardInserts([]int64{pending[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+	if size := walSize(t, dataDir); size != 0 {
+		t.Errorf("log holds %d bytes with nothing left to flush, want it truncated", size)
+	}
+}
+
+func TestReplayIgnoresTornRecord(t *testing.T) {
+	dataDir := t.TempDir()
+	wal, _ := openTestWAL(t, dataDir)
+	if _, err := wal.LogInsert("t", json.RawMessage(`[[1]]`)); err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+
+	file, err := os.OpenFile(filepath.Join(dataDir, WALFileName), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"id":2,"type":"insert","table":"t","rows":[[`)
+	file.Close()
+
+	_, pending := openTestWAL(t, dataDir)
+	if len(pending) != 1 || string(pending[0].Rows) != `[[1]]` {
+		t.Errorf("pending inserts are %+v, want only [[1]]", pending)
+	}
+}
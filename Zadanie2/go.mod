@@ -7,3 +7,15 @@ require github.com/pierrec/lz4/v4 v4.1.22
 require github.com/gorilla/mux v1.8.0
 
 require github.com/google/uuid v1.6.0
+
+require github.com/klauspost/compress v1.17.11
+
+require github.com/parquet-go/parquet-go v0.24.0
+
+require (
+	github.com/andybalholm/brotli v1.1.0 // indirect
+	github.com/mattn/go-runewidth v0.0.15 // indirect
+	github.com/olekukonko/tablewriter v0.0.5 // indirect
+	github.com/rivo/uniseg v0.4.7 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
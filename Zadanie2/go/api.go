@@ -13,6 +13,7 @@ package openapi
 import (
 	"context"
 	"net/http"
+	"os"
 )
 
 
@@ -24,8 +25,12 @@ type ExecutionAPIRouter interface {
 	GetQueries(http.ResponseWriter, *http.Request)
 	GetQueryById(http.ResponseWriter, *http.Request)
 	SubmitQuery(http.ResponseWriter, *http.Request)
+	CancelQuery(http.ResponseWriter, *http.Request)
+	StopQuery(http.ResponseWriter, *http.Request)
 	GetQueryResult(http.ResponseWriter, *http.Request)
 	GetQueryError(http.ResponseWriter, *http.Request)
+	UploadTableData(http.ResponseWriter, *http.Request)
+	InsertTableRows(http.ResponseWriter, *http.Request)
 }
 // MetadataAPIRouter defines the required methods for binding the api requests to a responses for the MetadataAPI
 // The MetadataAPIRouter implementation should parse necessary information from the http request,
@@ -41,9 +46,14 @@ type Proj3APIRouter interface {
 	GetTableById(http.ResponseWriter, *http.Request)
 	DeleteTable(http.ResponseWriter, *http.Request)
 	CreateTable(http.ResponseWriter, *http.Request)
+	InferTable(http.ResponseWriter, *http.Request)
+	UploadTableData(http.ResponseWriter, *http.Request)
+	InsertTableRows(http.ResponseWriter, *http.Request)
 	GetQueries(http.ResponseWriter, *http.Request)
 	GetQueryById(http.ResponseWriter, *http.Request)
 	SubmitQuery(http.ResponseWriter, *http.Request)
+	CancelQuery(http.ResponseWriter, *http.Request)
+	StopQuery(http.ResponseWriter, *http.Request)
 	GetQueryResult(http.ResponseWriter, *http.Request)
 	GetQueryError(http.ResponseWriter, *http.Request)
 	GetSystemInfo(http.ResponseWriter, *http.Request)
@@ -73,8 +83,12 @@ type ExecutionAPIServicer interface {
 	GetQueries(context.Context) (ImplResponse, error)
 	GetQueryById(context.Context, string) (ImplResponse, error)
 	SubmitQuery(context.Context, ExecuteQueryRequest) (ImplResponse, error)
+	CancelQuery(context.Context, string) (ImplResponse, error)
+	StopQuery(context.Context, string) (ImplResponse, error)
 	GetQueryResult(context.Context, string, GetQueryResultRequest) (ImplResponse, error)
 	GetQueryError(context.Context, string) (ImplResponse, error)
+	UploadTableData(context.Context, string, *os.File, QueryQueryDefinition) (ImplResponse, error)
+	InsertTableRows(context.Context, string, []interface{}) (ImplResponse, error)
 }
 
 
@@ -96,9 +110,14 @@ type Proj3APIServicer interface {
 	GetTableById(context.Context, string) (ImplResponse, error)
 	DeleteTable(context.Context, string) (ImplResponse, error)
 	CreateTable(context.Context, TableSchema) (ImplResponse, error)
+	InferTable(context.Context, InferTableRequest) (ImplResponse, error)
+	UploadTableData(context.Context, string, *os.File, QueryQueryDefinition) (ImplResponse, error)
+	InsertTableRows(context.Context, string, []interface{}) (ImplResponse, error)
 	GetQueries(context.Context) (ImplResponse, error)
 	GetQueryById(context.Context, string) (ImplResponse, error)
 	SubmitQuery(context.Context, ExecuteQueryRequest) (ImplResponse, error)
+	CancelQuery(context.Context, string) (ImplResponse, error)
+	StopQuery(context.Context, string) (ImplResponse, error)
 	GetQueryResult(context.Context, string, GetQueryResultRequest) (ImplResponse, error)
 	GetQueryError(context.Context, string) (ImplResponse, error)
 	GetSystemInfo(context.Context) (ImplResponse, error)
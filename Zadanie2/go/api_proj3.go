@@ -15,6 +15,7 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"os"
 	"strings"
 
 	"github.com/gorilla/mux"
@@ -77,6 +78,24 @@ func (c *Proj3APIController) Routes() Routes {
 			"/table",
 			c.CreateTable,
 		},
+		"InferTable": Route{
+			"InferTable",
+			strings.ToUpper("Post"),
+			"/table/infer",
+			c.InferTable,
+		},
+		"UploadTableData": Route{
+			"UploadTableData",
+			strings.ToUpper("Post"),
+			"/table/{tableId}/upload",
+			c.UploadTableData,
+		},
+		"InsertTableRows": Route{
+			"InsertTableRows",
+			strings.ToUpper("Post"),
+			"/table/{tableId}/rows",
+			c.InsertTableRows,
+		},
 		"GetQueries": Route{
 			"GetQueries",
 			strings.ToUpper("Get"),
@@ -95,6 +114,18 @@ func (c *Proj3APIController) Routes() Routes {
 			"/query",
 			c.SubmitQuery,
 		},
+		"CancelQuery": Route{
+			"CancelQuery",
+			strings.ToUpper("Delete"),
+			"/query/{queryId}",
+			c.CancelQuery,
+		},
+		"StopQuery": Route{
+			"StopQuery",
+			strings.ToUpper("Post"),
+			"/query/{queryId}/stop",
+			c.StopQuery,
+		},
 		"GetQueryResult": Route{
 			"GetQueryResult",
 			strings.ToUpper("Get"),
@@ -143,6 +174,24 @@ func (c *Proj3APIController) OrderedRoutes() []Route {
 			"/table",
 			c.CreateTable,
 		},
+		Route{
+			"InferTable",
+			strings.ToUpper("Post"),
+			"/table/infer",
+			c.InferTable,
+		},
+		Route{
+			"UploadTableData",
+			strings.ToUpper("Post"),
+			"/table/{tableId}/upload",
+			c.UploadTableData,
+		},
+		Route{
+			"InsertTableRows",
+			strings.ToUpper("Post"),
+			"/table/{tableId}/rows",
+			c.InsertTableRows,
+		},
 		Route{
 			"GetQueries",
 			strings.ToUpper("Get"),
@@ -161,6 +210,18 @@ func (c *Proj3APIController) OrderedRoutes() []Route {
 			"/query",
 			c.SubmitQuery,
 		},
+		Route{
+			"CancelQuery",
+			strings.ToUpper("Delete"),
+			"/query/{queryId}",
+			c.CancelQuery,
+		},
+		Route{
+			"StopQuery",
+			strings.ToUpper("Post"),
+			"/query/{queryId}/stop",
+			c.StopQuery,
+		},
 		Route{
 			"GetQueryResult",
 			strings.ToUpper("Get"),
@@ -259,6 +320,104 @@ func (c *Proj3APIController) CreateTable(w http.ResponseWriter, r *http.Request)
 	_ = EncodeJSONResponse(result.Body, &result.Code, w)
 }
 
+// InferTable - Create new table with the schema inferred from a CSV file and load the file into it
+func (c *Proj3APIController) InferTable(w http.ResponseWriter, r *http.Request) {
+	var inferTableRequestParam InferTableRequest
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&inferTableRequestParam); err != nil {
+		c.errorHandler(w, r, &ParsingError{Err: err}, nil)
+		return
+	}
+	if err := AssertInferTableRequestRequired(inferTableRequestParam); err != nil {
+		c.errorHandler(w, r, err, nil)
+		return
+	}
+	if err := AssertInferTableRequestConstraints(inferTableRequestParam); err != nil {
+		c.errorHandler(w, r, err, nil)
+		return
+	}
+	result, err := c.service.InferTable(r.Context(), inferTableRequestParam)
+	// If an error occurred, encode the error with the status code
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		return
+	}
+	// If no error, encode the body and the result code
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+}
+
+// UploadTableData - Upload a file (multipart/form-data or raw, possibly chunked, request body) and load it into selected table as a COPY query
+func (c *Proj3APIController) UploadTableData(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	query, err := parseQuery(r.URL.RawQuery)
+	if err != nil {
+		c.errorHandler(w, r, &ParsingError{Err: err}, nil)
+		return
+	}
+	tableIdParam := params["tableId"]
+	if tableIdParam == "" {
+		c.errorHandler(w, r, &RequiredError{"tableId"}, nil)
+		return
+	}
+	queryDefinitionParam, err := decodeCopyParams(query, uploadForbiddenParams)
+	if err != nil {
+		c.errorHandler(w, r, err, nil)
+		return
+	}
+	var fileParam *os.File
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		param, err := ReadFormFileToTempFile(r, "file")
+		if err != nil {
+			c.errorHandler(w, r, &ParsingError{Param: "file", Err: err}, nil)
+			return
+		}
+
+		fileParam = param
+	} else {
+		param, err := ReadBodyToTempFile(r)
+		if err != nil {
+			c.errorHandler(w, r, &ParsingError{Err: err}, nil)
+			return
+		}
+
+		fileParam = param
+	}
+	result, err := c.service.UploadTableData(r.Context(), tableIdParam, fileParam, queryDefinitionParam)
+	// If an error occurred, encode the error with the status code
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		return
+	}
+	// If no error, encode the body and the result code
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+}
+
+// InsertTableRows - Insert rows sent as JSON arrays or objects into selected table as a query
+func (c *Proj3APIController) InsertTableRows(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	tableIdParam := params["tableId"]
+	if tableIdParam == "" {
+		c.errorHandler(w, r, &RequiredError{"tableId"}, nil)
+		return
+	}
+	var rowsParam []interface{}
+	d := json.NewDecoder(r.Body)
+	d.UseNumber()
+	if err := d.Decode(&rowsParam); err != nil {
+		c.errorHandler(w, r, &ParsingError{Err: err}, nil)
+		return
+	}
+	result, err := c.service.InsertTableRows(r.Context(), tableIdParam, rowsParam)
+	// If an error occurred, encode the error with the status code
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		return
+	}
+	// If no error, encode the body and the result code
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+}
+
 // GetQueries - Get list of queries (optional in project 3, but useful). Use those IDs to get details by calling /query endpoint.
 func (c *Proj3APIController) GetQueries(w http.ResponseWriter, r *http.Request) {
 	result, err := c.service.GetQueries(r.Context())
@@ -289,6 +448,42 @@ func (c *Proj3APIController) GetQueryById(w http.ResponseWriter, r *http.Request
 	_ = EncodeJSONResponse(result.Body, &result.Code, w)
 }
 
+// CancelQuery - Cancel a queued or running query
+func (c *Proj3APIController) CancelQuery(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	queryIdParam := params["queryId"]
+	if queryIdParam == "" {
+		c.errorHandler(w, r, &RequiredError{"queryId"}, nil)
+		return
+	}
+	result, err := c.service.CancelQuery(r.Context(), queryIdParam)
+	// If an error occurred, encode the error with the status code
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		return
+	}
+	// If no error, encode the body and the result code
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+}
+
+// StopQuery - Stop a query following its source file
+func (c *Proj3APIController) StopQuery(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	queryIdParam := params["queryId"]
+	if queryIdParam == "" {
+		c.errorHandler(w, r, &RequiredError{"queryId"}, nil)
+		return
+	}
+	result, err := c.service.StopQuery(r.Context(), queryIdParam)
+	// If an error occurred, encode the error with the status code
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		return
+	}
+	// If no error, encode the body and the result code
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+}
+
 // SubmitQuery - Submit new query for execution
 func (c *Proj3APIController) SubmitQuery(w http.ResponseWriter, r *http.Request) {
 	var executeQueryRequestParam ExecuteQueryRequest
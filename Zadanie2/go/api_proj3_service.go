@@ -16,6 +16,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
 	"time"
 	"github.com/google/uuid"
 )
@@ -46,8 +47,10 @@ func convertColumns(cols []metastore.Column) []Column {
     out := make([]Column, len(cols))
     for i, c := range cols {
         out[i] = Column{
-            Name: c.Name,
-            Type: convertTypeToLogical(c.Type),
+            Name:     c.Name,
+            Type:     convertTypeToLogical(c.Type),
+            Default:  c.Default,
+            Nullable: c.Nullable,
         }
     }
     return out
@@ -60,11 +63,13 @@ type Proj3APIService struct {
 	scheduler *QueryScheduler
 }
 
-func NewProj3APIService(ms *metastore.Metastore) *Proj3APIService {
+func NewProj3APIService(ms *metastore.Metastore, cfg Config) *Proj3APIService {
 	qs := newQueryStore()
-	scheduler := NewQueryScheduler(ms, qs, 4, "data")
+	scheduler := NewQueryScheduler(ms, qs, "data", cfg)
 	scheduler.Start()
-	return &Proj3APIService{ms: ms, qs: qs, si: NewSystemInfo("1.0.1", "1", "Krzysztof Żyndul"), scheduler: scheduler}
+	si := NewSystemInfo("1.0.1", "1", "Krzysztof Żyndul")
+	si.Durability = string(cfg.Durability)
+	return &Proj3APIService{ms: ms, qs: qs, si: si, scheduler: scheduler}
 }
 
 func (s *Proj3APIService) Shutdown() {
@@ -136,6 +141,11 @@ func (s *Proj3APIService) DeleteTable(ctx context.Context, tableId string) (Impl
 			Message: "Deletion failed",
 		}), nil
 	}
+	if iq.GetStatus() == CANCELLED {
+		return Response(http.StatusConflict, Error{
+			Message: "Deletion was cancelled",
+		}), nil
+	}
 	return Response(http.StatusOK, "Table deleted"), nil
 }
 // TODO has to create empty fiels
@@ -152,8 +162,10 @@ func (s *Proj3APIService) CreateTable(
             return Response(http.StatusBadRequest, fmt.Sprintf("Invalid column type for column '%s': %v", c.Name, err)), nil
         }
         cols[i] = metastore.Column{
-            Name: c.Name,
-            Type: logicalType,
+            Name:     c.Name,
+            Type:     logicalType,
+            Default:  c.Default,
+            Nullable: c.Nullable,
         }
     }
 
@@ -184,21 +196,57 @@ func (s *Proj3APIService) GetQueryById(
     return Response(http.StatusOK, toPublic(iq)), nil
 }
 
+// CancelQuery cancels a query waiting in the queue or running. A running
+// query stops at its next check between batches; a cancelled load or insert
+// leaves the table unchanged.
+func (s *Proj3APIService) CancelQuery(ctx context.Context, queryId string) (ImplResponse, error) {
+	iq, ok := s.qs.get(queryId)
+	if !ok {
+		return Response(http.StatusNotFound, Error{Message: "Couldn't find a query of given ID"}), nil
+	}
+	if !iq.Cancel(time.Now()) {
+		return Response(http.StatusConflict, Error{Message: "Query has already finished"}), nil
+	}
+	return Response(http.StatusOK, toPublic(iq)), nil
+}
+
+// StopQuery asks a query following its source file to stop. The rows
+// appended so far are loaded before it completes, which the client sees by
+// polling the status of the query.
+func (s *Proj3APIService) StopQuery(ctx context.Context, queryId string) (ImplResponse, error) {
+	iq, ok := s.qs.get(queryId)
+	if !ok {
+		return Response(http.StatusNotFound, Error{Message: "Couldn't find a query of given ID"}), nil
+	}
+	if !iq.IsFollow {
+		return Response(http.StatusBadRequest, Error{Message: "Only queries following their source file can be stopped"}), nil
+	}
+
+	iq.requestStop()
+	return Response(http.StatusAccepted, toPublic(iq)), nil
+}
+
 func (s *Proj3APIService) SubmitQuery(
 	ctx context.Context,
 	executeQueryRequest ExecuteQueryRequest,
 ) (ImplResponse, error) {
+	return s.submitQuery(executeQueryRequest, false), nil
+}
 
+// submitQuery validates and submits a query. An upload is a COPY query whose
+// source file is a temporary copy of the uploaded data.
+func (s *Proj3APIService) submitQuery(executeQueryRequest ExecuteQueryRequest, isUpload bool) ImplResponse {
 	qd := executeQueryRequest.QueryDefinition
 
-	isSelect := qd.TableName != ""
+	isExport := qd.TableName != "" && qd.DestinationFilepath != ""
+	isSelect := qd.TableName != "" && !isExport
 	isLoad := qd.SourceFilepath != "" && qd.DestinationTableName != ""
 
-	if !isSelect && !isLoad {
+	if !isSelect && !isLoad && !isExport {
 		return Response(
 			http.StatusBadRequest,
-			"Invalid query definition: either TableName for SELECT or SourceFilepath and DestinationTableName for LOAD must be provided",
-		), nil
+			"Invalid query definition: either TableName for SELECT, SourceFilepath and DestinationTableName for LOAD or TableName and DestinationFilepath for COPY TO must be provided",
+		)
 	}
 
 	if isLoad {
@@ -207,17 +255,33 @@ func (s *Proj3APIService) SubmitQuery(
 			return Response(
 				http.StatusBadRequest,
 				fmt.Sprintf("Invalid query definition: destination table '%s' does not exist", qd.DestinationTableName),
-			), nil
+			)
+		}
+
+		if err := qd.validateCopy(); err != nil {
+			return Response(
+				http.StatusBadRequest,
+				fmt.Sprintf("Invalid query definition: %v", err),
+			)
 		}
 	}
 
-	if isSelect {
+	if isSelect || isExport {
 		_, err := s.ms.GetTableByName(qd.TableName)
 		if err != nil {
 			return Response(
 				http.StatusBadRequest,
 				fmt.Sprintf("Invalid query definition: table '%s' does not exist", qd.TableName),
-			), nil
+			)
+		}
+	}
+
+	if isExport {
+		if err := qd.validateExport(); err != nil {
+			return Response(
+				http.StatusBadRequest,
+				fmt.Sprintf("Invalid query definition: %v", err),
+			)
 		}
 	}
 
@@ -228,11 +292,109 @@ func (s *Proj3APIService) SubmitQuery(
 		IsResultAvailable: false,
 		IsSelect:          isSelect,
 		IsDelete:          false,
+		IsExport:          isExport,
+		IsUpload:          isUpload,
 		Submitted:         time.Now(),
 		Started:           nil,
 		Finished:          nil,
 		Error:             nil,
 		ResultRows:        QueryResultInner{},
+		Timeout:           time.Duration(executeQueryRequest.TimeoutMs) * time.Millisecond,
+	}
+
+	if isLoad && qd.Follow {
+		if iq.Timeout != 0 {
+			return Response(
+				http.StatusBadRequest,
+				"Invalid query definition: timeoutMs cannot be used with follow",
+			)
+		}
+		table, err := s.ms.GetTableByName(qd.DestinationTableName)
+		if err != nil {
+			return Response(
+				http.StatusBadRequest,
+				fmt.Sprintf("Invalid query definition: destination table '%s' does not exist", qd.DestinationTableName),
+			)
+		}
+		iq.IsFollow = true
+		iq.TableID = table.ID
+		iq.doneChan = make(chan struct{})
+		iq.stopFollow = make(chan struct{})
+
+		// added only once started, so that a job which failed to start does
+		// not stay listed as CREATED
+		if err := s.scheduler.StartFollow(iq); err != nil {
+			return Response(http.StatusInternalServerError, Error{Message: fmt.Sprintf("failed to start follow job: %v", err)})
+		}
+		s.qs.add(iq)
+		return Response(http.StatusOK, iq.ID)
+	}
+
+	s.qs.add(iq)
+	s.scheduler.SubmitQuery(iq.ID)
+
+	return Response(
+		http.StatusOK,
+		iq.ID,
+	)
+}
+
+// UploadTableData submits a COPY query loading a file uploaded with the
+// request, with the options given as query parameters. The temporary file
+// holding the upload is removed when the query finishes or is rejected.
+func (s *Proj3APIService) UploadTableData(
+	ctx context.Context,
+	tableId string,
+	file *os.File,
+	queryDefinition QueryQueryDefinition,
+) (ImplResponse, error) {
+	table, err := s.ms.GetTableById(tableId)
+	if err != nil {
+		os.Remove(file.Name())
+		return Response(http.StatusNotFound, Error{Message: err.Error()}), nil
+	}
+
+	queryDefinition.SourceFilepath = file.Name()
+	queryDefinition.DestinationTableName = table.Name
+	response := s.submitQuery(ExecuteQueryRequest{QueryDefinition: queryDefinition}, true)
+	if response.Code != http.StatusOK {
+		os.Remove(file.Name())
+	}
+	return response, nil
+}
+
+// InsertTableRows validates rows sent as JSON against the table columns and
+// submits a query inserting them.
+func (s *Proj3APIService) InsertTableRows(
+	ctx context.Context,
+	tableId string,
+	rows []interface{},
+) (ImplResponse, error) {
+	table, err := s.ms.GetTableById(tableId)
+	if err != nil {
+		return Response(http.StatusNotFound, Error{Message: err.Error()}), nil
+	}
+
+	values, problems, err := s.scheduler.parseInsertRows(table, rows)
+	if err != nil {
+		return Response(http.StatusBadRequest, MultipleProblemsError{
+			Problems: []MultipleProblemsErrorProblemsInner{{Error: err.Error()}},
+		}), nil
+	}
+	if len(problems) != 0 {
+		return Response(http.StatusBadRequest, MultipleProblemsError{Problems: problems}), nil
+	}
+
+	iq := &internalQuery{
+		ID:                uuid.NewString(),
+		QueryDefinition:   QueryQueryDefinition{DestinationTableName: table.Name},
+		Status:            CREATED,
+		IsResultAvailable: false,
+		IsInsert:          true,
+		TableID:           table.ID,
+		Submitted:         time.Now(),
+		ResultRows:        QueryResultInner{},
+		insertRows:        values,
 	}
 
 	s.qs.add(iq)
@@ -244,6 +406,56 @@ func (s *Proj3APIService) SubmitQuery(
 	), nil
 }
 
+// InferTable creates a table with the columns inferred from a sample of a CSV
+// file and submits a COPY query loading the whole file into it.
+func (s *Proj3APIService) InferTable(
+	ctx context.Context,
+	inferTableRequest InferTableRequest,
+) (ImplResponse, error) {
+	qd := inferTableRequest.copyQuery()
+	if err := qd.validateCopy(); err != nil {
+		return Response(
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid query definition: %v", err),
+		), nil
+	}
+
+	sampleRows := int(inferTableRequest.SampleRows)
+	if sampleRows == 0 {
+		sampleRows = defaultSampleRows
+	}
+	columns, err := inferCSVSchema(qd, sampleRows)
+	if err != nil {
+		return Response(
+			http.StatusBadRequest,
+			fmt.Sprintf("failed to infer schema of '%s': %v", qd.SourceFilepath, err),
+		), nil
+	}
+
+	created, err := s.CreateTable(ctx, TableSchema{Name: inferTableRequest.TableName, Columns: columns})
+	if err != nil || created.Code != http.StatusOK {
+		return created, err
+	}
+
+	iq := &internalQuery{
+		ID:                uuid.NewString(),
+		QueryDefinition:   qd,
+		Status:            CREATED,
+		IsResultAvailable: false,
+		Submitted:         time.Now(),
+		ResultRows:        QueryResultInner{},
+	}
+
+	s.qs.add(iq)
+	s.scheduler.SubmitQuery(iq.ID)
+
+	return Response(http.StatusOK, InferredTable{
+		TableId: created.Body.(string),
+		QueryId: iq.ID,
+		Columns: columns,
+	}), nil
+}
+
 func (s *Proj3APIService) GetQueryResult(ctx context.Context, queryId string, getQueryResultRequest GetQueryResultRequest) (ImplResponse, error) {
 	iq, ok := s.qs.get(queryId)
 	if !ok {
@@ -294,7 +506,8 @@ func (s *Proj3APIService) GetQueryError(ctx context.Context, queryId string) (Im
 		return Response(http.StatusNotFound, Error{Message: "Couldn't find a query of given ID"}), nil
 	}
 
-	if iq.GetStatus() != FAILED {
+	// completed loads report the rows they rejected
+	if iq.GetStatus() != FAILED && iq.GetError() == nil {
 		return Response(http.StatusBadRequest, Error{Message: "Error for this query is not available"}), nil
 	}
 
@@ -309,5 +522,6 @@ func (s *Proj3APIService) GetSystemInfo(ctx context.Context) (ImplResponse, erro
 		Version:          sysInfo.Version,
 		Author:           sysInfo.Author,
 		Uptime:           sysInfo.UptimeSeconds(),
+		Durability:       sysInfo.Durability,
 	}), nil
 }
\ No newline at end of file
@@ -0,0 +1,168 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// uploadTempDir makes uploads of the test write their temporary files into a
+// directory of their own.
+func uploadTempDir(t *testing.T) string {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	return dir
+}
+
+// waitEmpty waits until the temporary files of uploads have been removed.
+func waitEmpty(t *testing.T, dir string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("temporary upload files left: %v", entries)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// uploadedQuery decodes the query ID returned by the upload endpoint.
+func uploadedQuery(t *testing.T, code int, body *bytes.Buffer) string {
+	t.Helper()
+	if code != http.StatusOK {
+		t.Fatalf("upload failed: %d %s", code, body)
+	}
+	var id string
+	if err := json.Unmarshal(body.Bytes(), &id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestUploadBody(t *testing.T) {
+	tmp := uploadTempDir(t)
+	ts := newTestServer(t)
+	tableID := ts.createTable("t", intColumn("id"), stringColumn("name"))
+
+	params := url.Values{
+		"doesCsvContainHeader": {"true"},
+		"mapColumnsByHeader":   {"true"},
+		"columnRenames":        {`{"key": "id"}`},
+		"delimiter":            {";"},
+		"commentPrefix":        {"#"},
+		"trimSpaces":           {"true"},
+	}
+	body := "# uploaded\nname;key\n a ;1\nb;2\n"
+	response := ts.serve(http.MethodPost, "/table/"+tableID+"/upload?"+params.Encode(), "text/csv", strings.NewReader(body))
+	iq := ts.wait(uploadedQuery(t, response.Code, response.Body))
+	if iq.GetStatus() != COMPLETED {
+		t.Fatalf("upload ended %s: %s", iq.GetStatus(), problemsOf(iq))
+	}
+
+	want := [][]any{{int64(1), "a"}, {int64(2), "b"}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+	waitEmpty(t, tmp)
+}
+
+func TestUploadMultipart(t *testing.T) {
+	tmp := uploadTempDir(t)
+	ts := newTestServer(t)
+	tableID := ts.createTable("t", intColumn("id"))
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "t.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(compressTestData(t, compressionGzip, "1\n2\n"))
+	form.Close()
+
+	response := ts.serve(http.MethodPost, "/table/"+tableID+"/upload", form.FormDataContentType(), &body)
+	ts.wait(uploadedQuery(t, response.Code, response.Body))
+
+	want := [][]any{{int64(1)}, {int64(2)}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+	waitEmpty(t, tmp)
+}
+
+func TestUploadRejectsInvalidOptions(t *testing.T) {
+	tmp := uploadTempDir(t)
+	ts := newTestServer(t)
+	tableID := ts.createTable("t", intColumn("id"))
+
+	for _, query := range []string{
+		"follow=true",
+		"sourceFilepath=/etc/passwd",
+		"unknownOption=1",
+		"maxErrors=many",
+		"maxErrors=-1",
+		"columnRenames=%7B",
+	} {
+		response := ts.serve(http.MethodPost, "/table/"+tableID+"/upload?"+query, "text/csv", strings.NewReader("1\n"))
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d %s, want 400", query, response.Code, response.Body)
+		}
+	}
+	if got := ts.selectRows("t"); len(got) != 0 {
+		t.Errorf("rejected uploads loaded %v", got)
+	}
+	waitEmpty(t, tmp)
+}
+
+func TestFailedUploadRemovesTemporaryFile(t *testing.T) {
+	tmp := uploadTempDir(t)
+	ts := newTestServer(t)
+	tableID := ts.createTable("t", intColumn("id"))
+
+	response := ts.serve(http.MethodPost, "/table/"+tableID+"/upload", "text/csv", strings.NewReader("1\nx\n"))
+	if iq := ts.wait(uploadedQuery(t, response.Code, response.Body)); iq.GetStatus() != FAILED {
+		t.Errorf("upload of a bad row ended %s", iq.GetStatus())
+	}
+	waitEmpty(t, tmp)
+}
+
+func TestUploadCancelledInQueueRemovesTemporaryFile(t *testing.T) {
+	tmp := uploadTempDir(t)
+	cfg := testConfig()
+	cfg.QueryWorkers = 1
+	ts := newTestServerConfig(t, cfg)
+	ts.createTable("busy", intColumn("id"))
+	tableID := ts.createTable("t", intColumn("id"))
+
+	// the only worker waits for the lock of busy while the upload is queued
+	busy, _ := ts.ms.GetTableByName("busy")
+	busy.AcquireWrite()
+	blocker := ts.submit(QueryQueryDefinition{SourceFilepath: writeTestFile(t, t.TempDir(), "busy.csv", "1\n"), DestinationTableName: "busy"})
+
+	response := ts.serve(http.MethodPost, "/table/"+tableID+"/upload", "text/csv", strings.NewReader("1\n"))
+	id := uploadedQuery(t, response.Code, response.Body)
+	if cancelled := ts.serve(http.MethodDelete, "/query/"+id, "", nil); cancelled.Code != http.StatusOK {
+		t.Fatalf("cancel failed: %d %s", cancelled.Code, cancelled.Body)
+	}
+	busy.ReleaseWrite()
+
+	ts.wait(blocker)
+	if status := ts.wait(id).GetStatus(); status != CANCELLED {
+		t.Errorf("upload ended %s, want CANCELLED", status)
+	}
+	waitEmpty(t, tmp)
+}
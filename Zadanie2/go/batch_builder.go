@@ -0,0 +1,85 @@
+package openapi
+
+import (
+	"Zadanie2/deserializer"
+	"Zadanie2/metastore"
+	"strings"
+)
+
+// batchBuilder accumulates parsed rows of a table until they form a batch.
+type batchBuilder struct {
+	table      *metastore.Table
+	columnData [][]int64
+	strings    []strings.Builder
+	nulls      map[int][]int64
+	numRows    int
+}
+
+func newBatchBuilder(table *metastore.Table) *batchBuilder {
+	b := &batchBuilder{table: table}
+	b.reset()
+	return b
+}
+
+func (b *batchBuilder) reset() {
+	numCols := len(b.table.Columns)
+	b.columnData = make([][]int64, numCols)
+	b.strings = make([]strings.Builder, numCols)
+	b.nulls = make(map[int][]int64)
+	for colIdx, col := range b.table.Columns {
+		if col.Nullable {
+			b.nulls[colIdx] = []int64{}
+		}
+	}
+	b.numRows = 0
+}
+
+// appendRow adds one row; values are indexed by table column and must already
+// be parsed to the column type (int64 or string). A nil value is stored as
+// NULL, which only nullable columns accept.
+func (b *batchBuilder) appendRow(values []any) {
+	for colIdx, val := range values {
+		if val == nil {
+			b.nulls[colIdx] = append(b.nulls[colIdx], int64(b.numRows))
+			switch b.table.Columns[colIdx].Type {
+			case metastore.TypeInt:
+				val = int64(0)
+			case metastore.TypeString:
+				val = ""
+			}
+		}
+		switch b.table.Columns[colIdx].Type {
+		case metastore.TypeInt:
+			b.columnData[colIdx] = append(b.columnData[colIdx], val.(int64))
+		case metastore.TypeString:
+			b.columnData[colIdx] = append(b.columnData[colIdx], int64(b.strings[colIdx].Len()))
+			b.strings[colIdx].WriteString(val.(string))
+		}
+	}
+	b.numRows++
+}
+
+// build returns the accumulated rows as a batch and resets the builder.
+func (b *batchBuilder) build() *deserializer.Batch {
+	numCols := len(b.table.Columns)
+	stringsMap := make(map[int]string)
+	columnTypes := make([]byte, numCols)
+	for colIdx, col := range b.table.Columns {
+		columnTypes[colIdx] = byte(col.Type)
+		if col.Type == metastore.TypeString {
+			b.columnData[colIdx] = append(b.columnData[colIdx], int64(b.strings[colIdx].Len()))
+			stringsMap[colIdx] = b.strings[colIdx].String()
+		}
+	}
+
+	batch := &deserializer.Batch{
+		BatchSize:   int32(b.numRows),
+		NumColumns:  int32(numCols),
+		ColumnTypes: columnTypes,
+		Data:        b.columnData,
+		String:      stringsMap,
+		Nulls:       b.nulls,
+	}
+	b.reset()
+	return batch
+}
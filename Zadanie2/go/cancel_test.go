@@ -0,0 +1,165 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitStatus waits until the query has the status.
+func (ts *testServer) waitStatus(id string, status QueryStatus) *internalQuery {
+	ts.t.Helper()
+	iq, ok := ts.service.qs.get(id)
+	if !ok {
+		ts.t.Fatalf("query %s not found", id)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for iq.GetStatus() != status {
+		if time.Now().After(deadline) {
+			ts.t.Fatalf("query %s is %s, want %s", id, iq.GetStatus(), status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return iq
+}
+
+// cancel cancels a query through the API and returns the response code.
+func (ts *testServer) cancel(id string) int {
+	ts.t.Helper()
+	return ts.serve(http.MethodDelete, "/query/"+id, "", nil).Code
+}
+
+// runLocked submits a load into the table while a test holds the write lock
+// of the table, cancels it once it runs and then releases the lock.
+func (ts *testServer) runLocked(table string, qd QueryQueryDefinition) *internalQuery {
+	ts.t.Helper()
+	locked, err := ts.ms.GetTableByName(table)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	locked.AcquireWrite()
+	id := ts.submit(qd)
+	ts.waitStatus(id, RUNNING)
+	if code := ts.cancel(id); code != http.StatusOK {
+		ts.t.Errorf("cancel answered %d", code)
+	}
+	locked.ReleaseWrite()
+	return ts.wait(id)
+}
+
+func TestFailureOfCancelledQueryIsReported(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	missing := t.TempDir() + "/missing.csv"
+
+	// the load fails on its own before it checks the cancellation
+	iq := ts.runLocked("t", QueryQueryDefinition{SourceFilepath: missing, DestinationTableName: "t"})
+	if iq.GetStatus() != FAILED {
+		t.Fatalf("query ended %s, want FAILED", iq.GetStatus())
+	}
+	if problems := problemsOf(iq); !strings.Contains(problems, "failed to open source file") {
+		t.Errorf("problems %q do not report the failure", problems)
+	}
+}
+
+func TestCancelMultiFileLoad(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.csv", "1\n")
+	writeTestFile(t, dir, "b.csv", "2\n")
+
+	iq := ts.runLocked("t", QueryQueryDefinition{SourceFilepath: dir, DestinationTableName: "t", ParallelFiles: 2})
+	if iq.GetStatus() != CANCELLED {
+		t.Fatalf("query ended %s, want CANCELLED: %s", iq.GetStatus(), problemsOf(iq))
+	}
+	if got := ts.selectRows("t"); len(got) != 0 {
+		t.Errorf("cancelled load left rows %v", got)
+	}
+}
+
+func TestCancelQueuedQuery(t *testing.T) {
+	cfg := testConfig()
+	cfg.QueryWorkers = 1
+	ts := newTestServerConfig(t, cfg)
+	ts.createTable("t", intColumn("id"))
+	locked, err := ts.ms.GetTableByName("t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the only worker waits for the table lock
+	locked.AcquireWrite()
+	running := ts.submit(QueryQueryDefinition{TableName: "t"})
+	ts.waitStatus(running, RUNNING)
+	queued := ts.submit(QueryQueryDefinition{TableName: "t"})
+	if code := ts.cancel(queued); code != http.StatusOK {
+		t.Errorf("cancel answered %d", code)
+	}
+	iq := ts.waitStatus(queued, CANCELLED)
+	locked.ReleaseWrite()
+
+	if status := ts.wait(running).GetStatus(); status != COMPLETED {
+		t.Errorf("running query ended %s", status)
+	}
+	if iq.GetStatus() != CANCELLED || iq.GetIsResultAvailable() {
+		t.Errorf("cancelled query ended %s", iq.GetStatus())
+	}
+}
+
+func TestCancelRunningQueries(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "t.csv", "1\n2\n")
+	ts.mustComplete(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t"})
+
+	for name, qd := range map[string]QueryQueryDefinition{
+		"load":   {SourceFilepath: src, DestinationTableName: "t"},
+		"merge":  {SourceFilepath: src, DestinationTableName: "t", MergeKeyColumns: []string{"id"}},
+		"select": {TableName: "t"},
+		"export": {TableName: "t", DestinationFilepath: dir + "/out.csv"},
+	} {
+		if iq := ts.runLocked("t", qd); iq.GetStatus() != CANCELLED {
+			t.Errorf("%s ended %s, want CANCELLED: %s", name, iq.GetStatus(), problemsOf(iq))
+		}
+	}
+	want := [][]any{{int64(1)}, {int64(2)}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("cancelled loads changed the table to %v", got)
+	}
+}
+
+func TestCancelFinishedQuery(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	iq := ts.mustComplete(QueryQueryDefinition{TableName: "t"})
+
+	if code := ts.cancel(iq.ID); code != http.StatusConflict {
+		t.Errorf("cancelling a finished query answered %d", code)
+	}
+	if code := ts.cancel("missing"); code != http.StatusNotFound {
+		t.Errorf("cancelling a missing query answered %d", code)
+	}
+}
+
+func TestCancelFollowJob(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "1\n")
+	id := ts.submit(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", Follow: true})
+	ts.waitRowsProcessed(id, 1)
+
+	if code := ts.cancel(id); code != http.StatusOK {
+		t.Errorf("cancel answered %d", code)
+	}
+	if status := ts.wait(id).GetStatus(); status != CANCELLED {
+		t.Fatalf("follow job ended %s, want CANCELLED", status)
+	}
+	ts.restart()
+	if _, ok := ts.service.qs.get(id); ok {
+		t.Error("cancelled follow job resumed after restart")
+	}
+}
@@ -0,0 +1,90 @@
+package openapi
+
+import (
+	"Zadanie2/deserializer"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// defaultMemtableFlushInterval is how long inserted rows may stay buffered in
+// memory when DBMS_MEMTABLE_FLUSH_INTERVAL is not set.
+const defaultMemtableFlushInterval = 5 * time.Second
+
+// defaultQueryWorkers is the number of queries executed at a time when
+// DBMS_QUERY_WORKERS is not set.
+const defaultQueryWorkers = 4
+
+// Config holds the settings chosen per deployment. They are read from
+// environment variables.
+type Config struct {
+	// Durability is the fsync mode of loads and of the metastore
+	// (DBMS_DURABILITY: none, batch or commit).
+	Durability deserializer.Durability
+	// MemtableFlushInterval is the longest time inserted rows are buffered
+	// before being written to the table files
+	// (DBMS_MEMTABLE_FLUSH_INTERVAL: a Go duration such as 5s or 500ms).
+	MemtableFlushInterval time.Duration
+	// MaxQueryTime is the longest time a query may run, zero for no limit
+	// (DBMS_MAX_QUERY_TIME: a Go duration such as 10m).
+	MaxQueryTime time.Duration
+	// QueryWorkers is the number of queries executed at a time
+	// (DBMS_QUERY_WORKERS, default 4).
+	QueryWorkers int
+	// MaxThreads limits the goroutines executing queries: the query workers
+	// and the scan pool shared by all queries, which scans tables and parses
+	// CSV loads, together. The pool gets MaxThreads - QueryWorkers goroutines
+	// (DBMS_MAX_THREADS, default QueryWorkers plus the number of CPUs).
+	MaxThreads int
+}
+
+// LoadConfig reads the configuration from the environment; unset variables
+// take their default values.
+func LoadConfig() (Config, error) {
+	var cfg Config
+
+	durability, err := deserializer.ParseDurability(os.Getenv("DBMS_DURABILITY"))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Durability = durability
+
+	cfg.MemtableFlushInterval = defaultMemtableFlushInterval
+	if value := os.Getenv("DBMS_MEMTABLE_FLUSH_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return cfg, fmt.Errorf("invalid DBMS_MEMTABLE_FLUSH_INTERVAL '%s', expected a positive duration such as 5s", value)
+		}
+		cfg.MemtableFlushInterval = interval
+	}
+
+	if value := os.Getenv("DBMS_MAX_QUERY_TIME"); value != "" {
+		maxTime, err := time.ParseDuration(value)
+		if err != nil || maxTime <= 0 {
+			return cfg, fmt.Errorf("invalid DBMS_MAX_QUERY_TIME '%s', expected a positive duration such as 10m", value)
+		}
+		cfg.MaxQueryTime = maxTime
+	}
+
+	cfg.QueryWorkers = defaultQueryWorkers
+	if value := os.Getenv("DBMS_QUERY_WORKERS"); value != "" {
+		workers, err := strconv.Atoi(value)
+		if err != nil || workers <= 0 {
+			return cfg, fmt.Errorf("invalid DBMS_QUERY_WORKERS '%s', expected a positive number", value)
+		}
+		cfg.QueryWorkers = workers
+	}
+
+	cfg.MaxThreads = cfg.QueryWorkers + runtime.NumCPU()
+	if value := os.Getenv("DBMS_MAX_THREADS"); value != "" {
+		threads, err := strconv.Atoi(value)
+		if err != nil || threads <= cfg.QueryWorkers {
+			return cfg, fmt.Errorf("invalid DBMS_MAX_THREADS '%s', expected a number greater than the %d query workers", value, cfg.QueryWorkers)
+		}
+		cfg.MaxThreads = threads
+	}
+
+	return cfg, nil
+}
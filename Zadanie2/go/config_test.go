@@ -0,0 +1,25 @@
+package openapi
+
+import (
+	"Zadanie2/deserializer"
+	"testing"
+)
+
+func TestLoadConfigDurability(t *testing.T) {
+	t.Setenv("DBMS_DURABILITY", "")
+	cfg, err := LoadConfig()
+	if err != nil || cfg.Durability != deserializer.DurabilityCommit {
+		t.Errorf("default durability %q, %v, want commit", cfg.Durability, err)
+	}
+
+	t.Setenv("DBMS_DURABILITY", "batch")
+	cfg, err = LoadConfig()
+	if err != nil || cfg.Durability != deserializer.DurabilityBatch {
+		t.Errorf("durability %q, %v, want batch", cfg.Durability, err)
+	}
+
+	t.Setenv("DBMS_DURABILITY", "always")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("unknown durability mode accepted")
+	}
+}
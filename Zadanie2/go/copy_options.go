@@ -0,0 +1,164 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// validateCopy checks the options of a COPY query which can be verified
+// before the query is scheduled.
+func (query QueryQueryDefinition) validateCopy() error {
+	if _, err := query.csvDialect(); err != nil {
+		return err
+	}
+
+	if query.SourceFormat != "" && !query.SourceFormat.IsValid() {
+		return fmt.Errorf("invalid value '%s' for sourceFormat: valid values are %v", query.SourceFormat, AllowedSourceFormatEnumValues)
+	}
+	if query.sourceFormat() != CSV {
+		if query.DoesCsvContainHeader || query.MapColumnsByHeader || len(query.DestinationColumns) != 0 {
+			return fmt.Errorf("doesCsvContainHeader, mapColumnsByHeader and destinationColumns can only be used with CSV source format")
+		}
+	}
+	if len(query.JsonPaths) != 0 {
+		if query.sourceFormat() != NDJSON {
+			return fmt.Errorf("jsonPaths can only be used with NDJSON source format")
+		}
+		for column, pointer := range query.JsonPaths {
+			if _, err := parseJSONPointer(pointer); err != nil {
+				return fmt.Errorf("invalid JSON pointer for column '%s': %w", column, err)
+			}
+		}
+	}
+
+	if query.MapColumnsByHeader {
+		if !query.DoesCsvContainHeader {
+			return fmt.Errorf("mapColumnsByHeader requires doesCsvContainHeader")
+		}
+		if len(query.DestinationColumns) != 0 {
+			return fmt.Errorf("mapColumnsByHeader cannot be combined with destinationColumns")
+		}
+		if err := validateColumnRenames(query.ColumnRenames); err != nil {
+			return err
+		}
+	} else if len(query.ColumnRenames) != 0 {
+		return fmt.Errorf("columnRenames requires mapColumnsByHeader")
+	}
+
+	if query.MaxErrors < 0 {
+		return fmt.Errorf("maxErrors must not be negative")
+	}
+	if query.ParallelFiles < 0 {
+		return fmt.Errorf("parallelFiles must not be negative")
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range query.MergeKeyColumns {
+		if seen[name] {
+			return fmt.Errorf("column '%s' appears more than once in mergeKeyColumns", name)
+		}
+		seen[name] = true
+	}
+
+	if query.Follow {
+		if query.sourceFormat() == PARQUET {
+			return fmt.Errorf("follow can only be used with CSV and NDJSON source formats")
+		}
+		if strings.ContainsAny(query.SourceFilepath, "*?[") {
+			return fmt.Errorf("follow requires a single source file, not a glob pattern")
+		}
+		if len(query.MergeKeyColumns) != 0 {
+			return fmt.Errorf("follow cannot be combined with mergeKeyColumns")
+		}
+	}
+	return nil
+}
+
+// validateColumnRenames checks that every header name and every table column
+// appears in at most one rename. Names are matched case-insensitively, so
+// otherwise the rename applied would depend on the map iteration order.
+func validateColumnRenames(renames map[string]string) error {
+	froms := make([]string, 0, len(renames))
+	for from := range renames {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+
+	seenFrom := make(map[string]string)
+	seenTo := make(map[string]string)
+	for _, from := range froms {
+		to := renames[from]
+		if other, ok := seenFrom[strings.ToLower(from)]; ok {
+			return fmt.Errorf("columnRenames renames CSV column '%s' twice, as '%s' and '%s'", from, other, from)
+		}
+		if other, ok := seenTo[strings.ToLower(to)]; ok {
+			return fmt.Errorf("columnRenames maps both '%s' and '%s' to table column '%s'", other, from, to)
+		}
+		seenFrom[strings.ToLower(from)] = from
+		seenTo[strings.ToLower(to)] = from
+	}
+	return nil
+}
+
+// uploadForbiddenParams are the options of a COPY query an upload cannot set:
+// its source and destination come from the request itself.
+var uploadForbiddenParams = map[string]bool{
+	"tableName":            true,
+	"sourceFilepath":       true,
+	"destinationTableName": true,
+	"destinationFilepath":  true,
+	"destinationFormat":    true,
+	"follow":               true,
+}
+
+// decodeCopyParams reads the options of a COPY query from URL query
+// parameters named like the JSON fields of QueryQueryDefinition, so that an
+// upload accepts every option a COPY query does. Lists are comma separated and
+// maps are JSON objects.
+func decodeCopyParams(query url.Values, forbidden map[string]bool) (QueryQueryDefinition, error) {
+	var qd QueryQueryDefinition
+	fields := make(map[string]reflect.Value)
+	v := reflect.ValueOf(&qd).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		fields[name] = v.Field(i)
+	}
+
+	for name, values := range query {
+		field, ok := fields[name]
+		if !ok || forbidden[name] {
+			return qd, &ParsingError{Param: name, Err: errors.New("not an option of an uploaded COPY query")}
+		}
+		value := values[len(values)-1]
+
+		var err error
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Bool:
+			var b bool
+			b, err = strconv.ParseBool(value)
+			field.SetBool(b)
+		case reflect.Int32:
+			var n int64
+			n, err = strconv.ParseInt(value, 10, 32)
+			field.SetInt(n)
+		case reflect.Slice:
+			field.Set(reflect.ValueOf(strings.Split(value, ",")))
+		case reflect.Map:
+			err = json.Unmarshal([]byte(value), field.Addr().Interface())
+		default:
+			err = fmt.Errorf("unsupported option type %s", field.Type())
+		}
+		if err != nil {
+			return qd, &ParsingError{Param: name, Err: err}
+		}
+	}
+	return qd, nil
+}
@@ -0,0 +1,39 @@
+package openapi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateCopyColumnRenames(t *testing.T) {
+	tests := []struct {
+		name    string
+		renames map[string]string
+		err     string
+	}{
+		{name: "distinct", renames: map[string]string{"a": "x", "b": "y"}},
+		{name: "same target", renames: map[string]string{"a": "x", "b": "x"}, err: "maps both 'a' and 'b' to table column 'x'"},
+		{name: "same target in other case", renames: map[string]string{"a": "x", "b": "X"}, err: "maps both 'a' and 'b'"},
+		{name: "same header name in other case", renames: map[string]string{"A": "x", "a": "y"}, err: "renames CSV column 'a' twice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qd := QueryQueryDefinition{DoesCsvContainHeader: true, MapColumnsByHeader: true, ColumnRenames: tt.renames}
+			err := qd.validateCopy()
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateCopyColumnRenamesRequireHeaderMapping(t *testing.T) {
+	qd := QueryQueryDefinition{DoesCsvContainHeader: true, ColumnRenames: map[string]string{"a": "x"}}
+	if err := qd.validateCopy(); err == nil {
+		t.Error("columnRenames accepted without mapColumnsByHeader")
+	}
+}
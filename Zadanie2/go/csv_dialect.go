@@ -0,0 +1,346 @@
+package openapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// csvDialect describes how a CSV file is formatted. It is built from the
+// dialect options of a query definition.
+type csvDialect struct {
+	delimiter  rune
+	quote      byte
+	escape     byte // 0 when quotes are escaped by doubling them
+	nullMarker string
+	skipRows   int
+	comment    rune
+	trimSpaces bool
+	lazyQuotes bool
+}
+
+func (query QueryQueryDefinition) csvDialect() (csvDialect, error) {
+	d := csvDialect{
+		delimiter:  ',',
+		quote:      '"',
+		nullMarker: query.NullMarker,
+		skipRows:   int(query.SkipRows),
+		trimSpaces: query.TrimSpaces,
+		lazyQuotes: query.LazyQuotes,
+	}
+
+	if query.Delimiter != "" {
+		r, size := utf8.DecodeRuneInString(query.Delimiter)
+		if size != len(query.Delimiter) || r == utf8.RuneError {
+			return d, fmt.Errorf("delimiter must be a single character, got '%s'", query.Delimiter)
+		}
+		d.delimiter = r
+	}
+	if query.QuoteChar != "" {
+		if len(query.QuoteChar) != 1 {
+			return d, fmt.Errorf("quoteChar must be a single ASCII character, got '%s'", query.QuoteChar)
+		}
+		d.quote = query.QuoteChar[0]
+	}
+	if query.EscapeChar != "" {
+		if len(query.EscapeChar) != 1 {
+			return d, fmt.Errorf("escapeChar must be a single ASCII character, got '%s'", query.EscapeChar)
+		}
+		if query.EscapeChar[0] != d.quote {
+			d.escape = query.EscapeChar[0]
+		}
+	}
+	if query.CommentPrefix != "" {
+		r, size := utf8.DecodeRuneInString(query.CommentPrefix)
+		if size != len(query.CommentPrefix) || r == utf8.RuneError {
+			return d, fmt.Errorf("commentPrefix must be a single character, got '%s'", query.CommentPrefix)
+		}
+		d.comment = r
+	}
+	if query.SkipRows < 0 {
+		return d, fmt.Errorf("skipRows must not be negative")
+	}
+
+	if d.delimiter == rune(d.quote) || d.delimiter == '\r' || d.delimiter == '\n' {
+		return d, fmt.Errorf("invalid delimiter '%c'", d.delimiter)
+	}
+	if d.comment != 0 && (d.comment == d.delimiter || d.comment == rune(d.quote)) {
+		return d, fmt.Errorf("commentPrefix must differ from delimiter and quoteChar")
+	}
+	if d.escape != 0 && rune(d.escape) == d.delimiter {
+		return d, fmt.Errorf("escapeChar must differ from delimiter")
+	}
+	return d, nil
+}
+
+// newReader skips the leading rows and returns a csv.Reader configured for
+// the dialect.
+func (d csvDialect) newReader(r io.Reader) (*csv.Reader, error) {
+	br := bufio.NewReader(r)
+	if err := d.skipLeadingRows(br); err != nil {
+		return nil, err
+	}
+	return d.csvReader(br), nil
+}
+
+func (d csvDialect) skipLeadingRows(br *bufio.Reader) error {
+	for i := 0; i < d.skipRows; i++ {
+		if _, err := br.ReadString('\n'); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("failed to skip leading rows: %w", err)
+		}
+	}
+	return nil
+}
+
+// csvReader returns a csv.Reader configured for the dialect. csv.Reader only
+// understands '"' quoting with doubled quotes, so a custom quote character and
+// escape character are translated on the fly.
+func (d csvDialect) csvReader(br *bufio.Reader) *csv.Reader {
+	var src io.Reader = br
+	if d.quote != '"' || d.escape != 0 {
+		src = newDialectReader(br, d)
+	}
+
+	reader := csv.NewReader(src)
+	reader.Comma = d.delimiter
+	reader.Comment = d.comment
+	reader.LazyQuotes = d.lazyQuotes
+	reader.TrimLeadingSpace = d.trimSpaces
+	return reader
+}
+
+// field undoes the quote translation and applies trimming to a parsed field.
+func (d csvDialect) field(s string) string {
+	if d.quote != '"' {
+		s = strings.Map(func(r rune) rune {
+			switch r {
+			case '"':
+				return rune(d.quote)
+			case rune(d.quote):
+				return '"'
+			}
+			return r
+		}, s)
+	}
+	if d.trimSpaces {
+		s = strings.TrimSpace(s)
+	}
+	return s
+}
+
+// appendRecord appends a CSV record in the dialect to buf. Fields are quoted
+// only when needed; NULL values (nil) are written as the null marker, which
+// is an empty unquoted field unless set.
+func (d csvDialect) appendRecord(buf []byte, fields []*string) []byte {
+	for i, field := range fields {
+		if i > 0 {
+			buf = utf8.AppendRune(buf, d.delimiter)
+		}
+		if field == nil {
+			buf = append(buf, d.nullMarker...)
+			continue
+		}
+		if !d.needsQuotes(*field, len(fields)) {
+			buf = append(buf, *field...)
+			continue
+		}
+
+		buf = append(buf, d.quote)
+		for j := 0; j < len(*field); j++ {
+			c := (*field)[j]
+			switch {
+			case c == d.quote && d.escape != 0:
+				buf = append(buf, d.escape, c)
+			case c == d.quote:
+				buf = append(buf, c, c)
+			case c == d.escape && d.escape != 0:
+				buf = append(buf, c, c)
+			default:
+				buf = append(buf, c)
+			}
+		}
+		buf = append(buf, d.quote)
+	}
+	return append(buf, '\n')
+}
+
+func (d csvDialect) needsQuotes(s string, numFields int) bool {
+	if s == "" {
+		// a record made of a single empty field would be an empty line, and
+		// without a null marker an unquoted empty field stands for NULL
+		return numFields == 1 || d.nullMarker == ""
+	}
+	if s[0] == ' ' || s[0] == '\t' || (d.comment != 0 && strings.HasPrefix(s, string(d.comment))) {
+		return true
+	}
+	return strings.ContainsRune(s, d.delimiter) ||
+		strings.ContainsAny(s, "\r\n") ||
+		strings.IndexByte(s, d.quote) >= 0 ||
+		(d.escape != 0 && strings.IndexByte(s, d.escape) >= 0)
+}
+
+func (d csvDialect) isNull(s string) bool {
+	return d.nullMarker != "" && s == d.nullMarker
+}
+
+// dialectReader rewrites a CSV stream into the form csv.Reader expects: the
+// custom quote character and '"' swap places, and an escaped or doubled quote
+// inside a quoted field becomes a doubled '"'. Like csvSplitter it follows the
+// quoting: escape characters outside quoted fields are ordinary characters,
+// and quote characters inside unquoted fields are left to csv.Reader to
+// reject or, with lazyQuotes, keep.
+type dialectReader struct {
+	r            *bufio.Reader
+	dialect      csvDialect
+	delimiter    []byte
+	comment      []byte
+	pending      []byte
+	inQuotes     bool
+	inComment    bool
+	atLineStart  bool
+	atFieldStart bool
+}
+
+func newDialectReader(r *bufio.Reader, d csvDialect) *dialectReader {
+	t := &dialectReader{
+		r:            r,
+		dialect:      d,
+		delimiter:    []byte(string(d.delimiter)),
+		atLineStart:  true,
+		atFieldStart: true,
+	}
+	if d.comment != 0 {
+		t.comment = []byte(string(d.comment))
+	}
+	return t
+}
+
+func (t *dialectReader) swap(c byte) byte {
+	if t.dialect.quote == '"' {
+		return c
+	}
+	switch c {
+	case t.dialect.quote:
+		return '"'
+	case '"':
+		return t.dialect.quote
+	}
+	return c
+}
+
+// startsWith reports whether c and the bytes following it are prefix.
+func (t *dialectReader) startsWith(c byte, prefix []byte) bool {
+	if len(prefix) == 0 || c != prefix[0] {
+		return false
+	}
+	next, err := t.r.Peek(len(prefix) - 1)
+	return err == nil && bytes.Equal(next, prefix[1:])
+}
+
+func (t *dialectReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(t.pending) > 0 {
+			copied := copy(p[n:], t.pending)
+			t.pending = t.pending[copied:]
+			n += copied
+			continue
+		}
+		if n > 0 && t.r.Buffered() == 0 {
+			break
+		}
+
+		c, err := t.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		t.pending = t.translate(c, t.pending[:0])
+	}
+	return n, nil
+}
+
+// translate appends the rewritten form of c, and of the bytes following it
+// which it consumes, to out.
+func (t *dialectReader) translate(c byte, out []byte) []byte {
+	d := t.dialect
+	atLineStart := t.atLineStart
+	t.atLineStart = false
+
+	switch {
+	case t.inQuotes:
+		return t.translateQuoted(c, out)
+	case t.inComment || (atLineStart && t.startsWith(c, t.comment)):
+		// csv.Reader skips the whole line, whatever it contains
+		t.inComment = c != '\n'
+		t.atLineStart, t.atFieldStart = !t.inComment, !t.inComment
+		return append(out, c)
+	case c == '\n':
+		t.atLineStart, t.atFieldStart = true, true
+		return append(out, c)
+	case t.startsWith(c, t.delimiter):
+		t.r.Discard(len(t.delimiter) - 1)
+		t.atFieldStart = true
+		return append(out, t.delimiter...)
+	case c == d.quote && t.atFieldStart:
+		t.inQuotes = true
+		t.atFieldStart = false
+		return append(out, '"')
+	case d.trimSpaces && t.atFieldStart && (c == ' ' || c == '\t'):
+		return append(out, c)
+	}
+	t.atFieldStart = false
+	return append(out, t.swap(c))
+}
+
+// translateQuoted handles a byte inside a quoted field.
+func (t *dialectReader) translateQuoted(c byte, out []byte) []byte {
+	d := t.dialect
+	switch {
+	case d.escape != 0 && c == d.escape:
+		if next, err := t.r.Peek(1); err == nil && (next[0] == d.quote || next[0] == d.escape) {
+			escaped := next[0]
+			t.r.Discard(1)
+			return t.appendQuoted(out, escaped)
+		}
+		return t.appendQuoted(out, c)
+	case c == d.quote:
+		if next, err := t.r.Peek(1); err == nil && next[0] == d.quote {
+			t.r.Discard(1)
+			return append(out, '"', '"')
+		}
+		// with lazyQuotes csv.Reader keeps a quote which is not followed by
+		// the end of the field, and stays inside the quoted field
+		if !d.lazyQuotes || t.atFieldEnd() {
+			t.inQuotes = false
+		}
+		return append(out, '"')
+	}
+	return t.appendQuoted(out, c)
+}
+
+// appendQuoted appends the literal character c of a quoted field.
+func (t *dialectReader) appendQuoted(out []byte, c byte) []byte {
+	if c == t.dialect.quote {
+		return append(out, '"', '"')
+	}
+	return append(out, t.swap(c))
+}
+
+// atFieldEnd reports whether the next bytes end a field.
+func (t *dialectReader) atFieldEnd() bool {
+	next, err := t.r.Peek(len(t.delimiter))
+	if len(next) == 0 {
+		return err != nil
+	}
+	return next[0] == '\n' || next[0] == '\r' || bytes.Equal(next, t.delimiter)
+}
@@ -0,0 +1,143 @@
+package openapi
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readDialect parses input with the dialect of query the way loads do.
+func readDialect(t *testing.T, query QueryQueryDefinition, input string) [][]string {
+	t.Helper()
+	d, err := query.csvDialect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := d.csvReader(bufio.NewReader(strings.NewReader(input))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		for i := range record {
+			record[i] = d.field(record[i])
+		}
+	}
+	return records
+}
+
+func TestDialectReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		query QueryQueryDefinition
+		input string
+		want  [][]string
+	}{
+		{
+			name:  "custom quote",
+			query: QueryQueryDefinition{QuoteChar: "'"},
+			input: "'a,b',c\n'it''s',x\n",
+			want:  [][]string{{"a,b", "c"}, {"it's", "x"}},
+		},
+		{
+			name:  "double quotes with custom quote",
+			query: QueryQueryDefinition{QuoteChar: "'"},
+			input: "'say \"hi\"',y\na\"b,c\n",
+			want:  [][]string{{`say "hi"`, "y"}, {`a"b`, "c"}},
+		},
+		{
+			name:  "escaped quote",
+			query: QueryQueryDefinition{EscapeChar: `\`},
+			input: `"a\"b","c\\d"` + "\n",
+			want:  [][]string{{`a"b`, `c\d`}},
+		},
+		{
+			name:  "escape outside quotes",
+			query: QueryQueryDefinition{EscapeChar: `\`},
+			input: `a\b,c\` + "\n",
+			want:  [][]string{{`a\b`, `c\`}},
+		},
+		{
+			name:  "escape before ordinary character",
+			query: QueryQueryDefinition{EscapeChar: `\`},
+			input: `"a\nb"` + "\n",
+			want:  [][]string{{`a\nb`}},
+		},
+		{
+			name:  "custom quote and escape",
+			query: QueryQueryDefinition{QuoteChar: "'", EscapeChar: `\`},
+			input: `'it\'s','"',"x"` + "\n",
+			want:  [][]string{{"it's", `"`, `"x"`}},
+		},
+		{
+			name:  "double quote as escape",
+			query: QueryQueryDefinition{QuoteChar: "'", EscapeChar: `"`},
+			input: `'a"'b','c""d'` + "\n",
+			want:  [][]string{{"a'b", `c"d`}},
+		},
+		{
+			name:  "quote inside unquoted field",
+			query: QueryQueryDefinition{QuoteChar: "'", LazyQuotes: true},
+			input: "it's,x\n",
+			want:  [][]string{{"it's", "x"}},
+		},
+		{
+			name:  "lazy quote inside quoted field",
+			query: QueryQueryDefinition{QuoteChar: "'", LazyQuotes: true},
+			input: "'a'b',c\n",
+			want:  [][]string{{"a'b", "c"}},
+		},
+		{
+			name:  "comment line",
+			query: QueryQueryDefinition{QuoteChar: "'", EscapeChar: `\`, CommentPrefix: "#"},
+			input: "# it's a 'comment\\\n'a',b\n",
+			want:  [][]string{{"a", "b"}},
+		},
+		{
+			name:  "multibyte delimiter",
+			query: QueryQueryDefinition{QuoteChar: "'", Delimiter: "§"},
+			input: "'a§b'§c\n",
+			want:  [][]string{{"a§b", "c"}},
+		},
+		{
+			name:  "quoted newline",
+			query: QueryQueryDefinition{QuoteChar: "'", EscapeChar: `\`},
+			input: "'a\nb\\'',c\n",
+			want:  [][]string{{"a\nb'", "c"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readDialect(t, tt.query, tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendRecordRoundTrip(t *testing.T) {
+	queries := []QueryQueryDefinition{
+		{},
+		{QuoteChar: "'"},
+		{EscapeChar: `\`},
+		{QuoteChar: "'", EscapeChar: `\`, Delimiter: ";"},
+	}
+	values := []string{"plain", "", "a,b", "a;b", `say "hi"`, "it's", `back\slash`, "two\nlines", " lead"}
+
+	for _, query := range queries {
+		d, err := query.csvDialect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields := make([]*string, len(values))
+		for i := range values {
+			fields[i] = &values[i]
+		}
+		input := string(d.appendRecord(nil, fields))
+		got := readDialect(t, query, input)
+		if want := [][]string{values}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%+v: %q read back as %q", query, input, got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package openapi
+
+import (
+	"Zadanie2/deserializer"
+	"Zadanie2/metastore"
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// csvSink writes table batches as CSV records in the dialect of the query,
+// optionally preceded by a header row with the column names.
+type csvSink struct {
+	writer  *bufio.Writer
+	dialect csvDialect
+	buf     []byte
+}
+
+func newCSVSink(w io.Writer, table *metastore.Table, dialect csvDialect, header bool) (*csvSink, error) {
+	sink := &csvSink{writer: bufio.NewWriter(w), dialect: dialect}
+	if header {
+		names := make([]*string, len(table.Columns))
+		for idx := range table.Columns {
+			names[idx] = &table.Columns[idx].Name
+		}
+		if _, err := sink.writer.Write(dialect.appendRecord(nil, names)); err != nil {
+			return nil, err
+		}
+	}
+	return sink, nil
+}
+
+func (sink *csvSink) writeBatch(batch *deserializer.Batch) error {
+	columns := make([][]interface{}, batch.NumColumns)
+	for idx := range columns {
+		columns[idx] = batchColumnValues(batch, idx)
+	}
+
+	fields := make([]*string, len(columns))
+	for row := 0; row < int(batch.BatchSize); row++ {
+		for idx, col := range columns {
+			fields[idx] = formatValue(col[row])
+		}
+		sink.buf = sink.dialect.appendRecord(sink.buf[:0], fields)
+		if _, err := sink.writer.Write(sink.buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sink *csvSink) close() error {
+	return sink.writer.Flush()
+}
+
+// formatValue returns the text of a value read from a batch, nil for NULL.
+func formatValue(val interface{}) *string {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case string:
+		return &v
+	case int64:
+		text := strconv.FormatInt(v, 10)
+		return &text
+	default:
+		text := fmt.Sprint(v)
+		return &text
+	}
+}
@@ -0,0 +1,176 @@
+package openapi
+
+import (
+	"Zadanie2/deserializer"
+	"Zadanie2/metastore"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// exportSink writes the batches of a table into a COPY TO destination file.
+type exportSink interface {
+	writeBatch(batch *deserializer.Batch) error
+	// close finishes the file; it is not called when the export fails.
+	close() error
+}
+
+func (query QueryQueryDefinition) destinationFormat() SourceFormat {
+	if query.DestinationFormat == "" {
+		return CSV
+	}
+	return query.DestinationFormat
+}
+
+// validateExport checks the options of a COPY TO query which can be verified
+// before the query is scheduled.
+func (query QueryQueryDefinition) validateExport() error {
+	if query.DestinationFormat != "" && !query.DestinationFormat.IsValid() {
+		return fmt.Errorf("invalid value '%s' for destinationFormat: valid values are %v", query.DestinationFormat, AllowedSourceFormatEnumValues)
+	}
+	if _, err := query.csvDialect(); err != nil {
+		return err
+	}
+	if options := query.loadOnlyOptions(); len(options) != 0 {
+		return fmt.Errorf("%s can only be used when loading data", strings.Join(options, ", "))
+	}
+	if query.destinationFormat() != CSV {
+		if query.DoesCsvContainHeader || query.Delimiter != "" || query.QuoteChar != "" || query.EscapeChar != "" || query.NullMarker != "" {
+			return fmt.Errorf("doesCsvContainHeader, delimiter, quoteChar, escapeChar and nullMarker can only be used with CSV destination format")
+		}
+	}
+	return nil
+}
+
+// loadOnlyOptions returns the names of the options set on the query which
+// only affect reading a source file, so that an export does not silently
+// ignore them.
+func (query QueryQueryDefinition) loadOnlyOptions() []string {
+	options := []struct {
+		name string
+		set  bool
+	}{
+		{"skipRows", query.SkipRows != 0},
+		{"commentPrefix", query.CommentPrefix != ""},
+		{"trimSpaces", query.TrimSpaces},
+		{"lazyQuotes", query.LazyQuotes},
+		{"maxErrors", query.MaxErrors != 0},
+		{"rejectsFilepath", query.RejectsFilepath != ""},
+		{"mapColumnsByHeader", query.MapColumnsByHeader},
+		{"columnRenames", len(query.ColumnRenames) != 0},
+		{"destinationColumns", len(query.DestinationColumns) != 0},
+		{"parallelFiles", query.ParallelFiles != 0},
+		{"mergeKeyColumns", len(query.MergeKeyColumns) != 0},
+		{"follow", query.Follow},
+		{"sourceFormat", query.SourceFormat != ""},
+		{"jsonPaths", len(query.JsonPaths) != 0},
+	}
+	var set []string
+	for _, option := range options {
+		if option.set {
+			set = append(set, option.name)
+		}
+	}
+	return set
+}
+
+// executeExport writes all rows of the table into the destination file one
+// batch at a time, holding only a single batch in memory. The destination is
+// written under a temporary name and renamed when complete, so a failed
+// export does not leave a truncated file behind.
+func (sched *QueryScheduler) executeExport(iq *internalQuery) error {
+	qd := iq.QueryDefinition
+
+	table, err := sched.ms.GetTableByName(qd.TableName)
+	if err != nil {
+		return err
+	}
+
+	table.AcquireRead()
+	defer table.ReleaseRead()
+
+	if err := sched.exportData(iq, table); err != nil {
+		return fmt.Errorf("failed to export %s data: %w", qd.destinationFormat(), err)
+	}
+	return nil
+}
+
+func (sched *QueryScheduler) exportData(iq *internalQuery, table *metastore.Table) error {
+	qd := iq.QueryDefinition
+
+	des, err := deserializer.NewBatchDeserializer(filepath.Join(sched.dataDir, table.Name))
+	if err != nil {
+		return fmt.Errorf("failed to create deserializer: %w", err)
+	}
+	numBatches, err := des.GetNumBatches()
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	tmpPath := qd.DestinationFilepath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create destination file: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			file.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	dialect, err := qd.csvDialect()
+	if err != nil {
+		return err
+	}
+
+	var sink exportSink
+	switch qd.destinationFormat() {
+	case PARQUET:
+		sink, err = newParquetSink(file, table)
+	case NDJSON:
+		sink, err = newNDJSONSink(file, table)
+	default:
+		sink, err = newCSVSink(file, table, dialect, qd.DoesCsvContainHeader)
+	}
+	if err != nil {
+		return err
+	}
+
+	var rowCount int64
+	for batchIdx := 0; batchIdx < numBatches; batchIdx++ {
+		if err := iq.checkCancelled(); err != nil {
+			return err
+		}
+		batch, err := des.ReadBatch(batchIdx)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		if err := sink.writeBatch(batch); err != nil {
+			return fmt.Errorf("failed to write destination file: %w", err)
+		}
+		rowCount += int64(batch.BatchSize)
+		iq.SetRowsProcessed(rowCount)
+	}
+	for _, batch := range sched.memtableBatches(table) {
+		if err := sink.writeBatch(batch); err != nil {
+			return fmt.Errorf("failed to write destination file: %w", err)
+		}
+		rowCount += int64(batch.BatchSize)
+		iq.SetRowsProcessed(rowCount)
+	}
+
+	if err := sink.close(); err != nil {
+		return fmt.Errorf("failed to write destination file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write destination file: %w", err)
+	}
+	if err := os.Rename(tmpPath, qd.DestinationFilepath); err != nil {
+		return fmt.Errorf("failed to move destination file into place: %w", err)
+	}
+	committed = true
+	return nil
+}
@@ -0,0 +1,127 @@
+package openapi
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// exportTestTable creates a table holding NULLs, an empty string and values
+// which have to be quoted in CSV.
+func exportTestTable(ts *testServer, dir string) {
+	ts.t.Helper()
+	ts.createTable("t", intColumn("id"), Column{Name: "name", Type: VARCHAR, Nullable: true})
+	src := writeTestFile(ts.t, dir, "t.csv", "1,plain\n2,'a;b'\n3,'it''s'\n4,NULL\n5,''\n")
+	ts.mustComplete(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", QuoteChar: "'", NullMarker: "NULL"})
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestExportCSV(t *testing.T) {
+	ts := newTestServer(t)
+	dir := t.TempDir()
+	exportTestTable(ts, dir)
+
+	tests := []struct {
+		name  string
+		query QueryQueryDefinition
+		want  string
+	}{
+		{
+			name:  "default dialect",
+			query: QueryQueryDefinition{},
+			want:  "1,plain\n2,a;b\n3,it's\n4,\n5,\"\"\n",
+		},
+		{
+			name:  "custom dialect with header",
+			query: QueryQueryDefinition{DoesCsvContainHeader: true, Delimiter: ";", QuoteChar: "'", EscapeChar: `\`, NullMarker: `\N`},
+			want:  "id;name\n1;plain\n2;'a;b'\n3;'it\\'s'\n4;\\N\n5;\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qd := tt.query
+			qd.TableName = "t"
+			qd.DestinationFilepath = filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_")+".csv")
+			ts.mustComplete(qd)
+			if got := readTestFile(t, qd.DestinationFilepath); got != tt.want {
+				t.Errorf("exported %q, want %q", got, tt.want)
+			}
+
+			// the file loads back with the same options
+			table := strings.ReplaceAll(tt.name, " ", "_")
+			ts.createTable(table, intColumn("id"), Column{Name: "name", Type: VARCHAR, Nullable: true})
+			load := tt.query
+			load.SourceFilepath = qd.DestinationFilepath
+			load.DestinationTableName = table
+			ts.mustComplete(load)
+		})
+	}
+
+	// NULL and the empty string stay distinct with a null marker
+	got := ts.selectRows("custom_dialect_with_header")
+	if want := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("reloaded table holds %v, want %v", got, want)
+	}
+}
+
+func TestExportNDJSON(t *testing.T) {
+	ts := newTestServer(t)
+	dir := t.TempDir()
+	exportTestTable(ts, dir)
+
+	dst := filepath.Join(dir, "t.ndjson")
+	ts.mustComplete(QueryQueryDefinition{TableName: "t", DestinationFilepath: dst, DestinationFormat: NDJSON})
+
+	want := `{"id":1,"name":"plain"}
+{"id":2,"name":"a;b"}
+{"id":3,"name":"it's"}
+{"id":4,"name":null}
+{"id":5,"name":""}
+`
+	if got := readTestFile(t, dst); got != want {
+		t.Errorf("exported %q, want %q", got, want)
+	}
+}
+
+func TestExportRejectsLoadOptions(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	dst := filepath.Join(t.TempDir(), "t.csv")
+
+	for _, qd := range []QueryQueryDefinition{
+		{SkipRows: 1},
+		{CommentPrefix: "#"},
+		{TrimSpaces: true},
+		{LazyQuotes: true},
+		{MaxErrors: 10},
+		{DestinationFormat: NDJSON, NullMarker: "NULL"},
+	} {
+		qd.TableName = "t"
+		qd.DestinationFilepath = dst
+		ts.rejected(qd)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("rejected export wrote %s: %v", dst, err)
+	}
+}
+
+func TestFailedExportLeavesNoFile(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	dst := filepath.Join(t.TempDir(), "missing", "t.csv")
+
+	ts.mustFail(QueryQueryDefinition{TableName: "t", DestinationFilepath: dst})
+	if entries, _ := os.ReadDir(filepath.Dir(filepath.Dir(dst))); len(entries) != 0 {
+		t.Errorf("failed export left %v", entries)
+	}
+}
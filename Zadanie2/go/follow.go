@@ -0,0 +1,447 @@
+package openapi
+
+import (
+	"Zadanie2/deserializer"
+	"Zadanie2/metastore"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// followPollInterval is how often a followed source file is checked for
+// appended rows.
+const followPollInterval = time.Second
+
+// followMaxChunk is the largest part of a followed source file loaded in one
+// micro-batch; a single row must not be longer.
+const followMaxChunk = 16 << 20
+
+// followDir is the directory of the data directory holding the checkpoints of
+// follow jobs. Table names cannot start with '.', so it cannot clash with a
+// table directory.
+const followDir = ".follow"
+
+// followCheckpoint is the persistent state of a follow job. It is replaced in
+// the same publication as the rows of every micro-batch, so after a crash the
+// job resumes exactly after the last published row.
+type followCheckpoint struct {
+	QueryID         string               `json:"queryId"`
+	TableID         string               `json:"tableId"`
+	QueryDefinition QueryQueryDefinition `json:"queryDefinition"`
+	Submitted       time.Time            `json:"submitted"`
+	Offset          int64                `json:"offset"`           // bytes of the source file loaded
+	Line            int                  `json:"line"`             // lines of the source file before Offset
+	SkippedRows     int                  `json:"skippedRows"`      // leading rows skipped so far
+	Header          []string             `json:"header,omitempty"` // CSV header, once read
+	RowsProcessed   int64                `json:"rowsProcessed"`
+	Rejected        int                  `json:"rejected"`
+	RejectsSize     int64                `json:"rejectsSize"` // bytes of the rejects file written by published micro-batches
+}
+
+func (sched *QueryScheduler) followCheckpointPath(queryID string) string {
+	return filepath.Join(sched.dataDir, followDir, queryID+".json")
+}
+
+// StartFollow starts a COPY query which follows its source file. Unlike other
+// queries it does not take a worker: every follow job runs until it is
+// stopped, fails or the server shuts down, in which case it is resumed from
+// its checkpoint on the next start.
+func (sched *QueryScheduler) StartFollow(iq *internalQuery) error {
+	cp := &followCheckpoint{
+		QueryID:         iq.ID,
+		TableID:         iq.TableID,
+		QueryDefinition: iq.QueryDefinition,
+		Submitted:       iq.Submitted,
+	}
+	if err := os.MkdirAll(filepath.Join(sched.dataDir, followDir), 0755); err != nil {
+		return err
+	}
+	if err := sched.saveFollowCheckpoint(cp); err != nil {
+		return err
+	}
+
+	sched.wg.Add(1)
+	go sched.runFollow(iq, cp)
+	return nil
+}
+
+func (sched *QueryScheduler) saveFollowCheckpoint(cp *followCheckpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return deserializer.WriteState(sched.followCheckpointPath(cp.QueryID), data, sched.durability != deserializer.DurabilityNone)
+}
+
+// resumeFollowJobs restarts the follow jobs whose checkpoints were left by a
+// previous run. They keep their query IDs.
+func (sched *QueryScheduler) resumeFollowJobs() {
+	dir := filepath.Join(sched.dataDir, followDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if filepath.Ext(entry.Name()) != ".json" {
+			// a checkpoint whose replacement was interrupted
+			os.Remove(path)
+			continue
+		}
+		data, err := os.ReadFile(path)
+		var cp followCheckpoint
+		if err == nil {
+			err = json.Unmarshal(data, &cp)
+		}
+		if err != nil {
+			log.Printf("failed to resume follow job %s: %v", entry.Name(), err)
+			continue
+		}
+
+		iq := &internalQuery{
+			ID:              cp.QueryID,
+			QueryDefinition: cp.QueryDefinition,
+			Status:          CREATED,
+			IsFollow:        true,
+			TableID:         cp.TableID,
+			Submitted:       cp.Submitted,
+			RowsProcessed:   cp.RowsProcessed,
+			doneChan:        make(chan struct{}),
+			stopFollow:      make(chan struct{}),
+		}
+		sched.qs.add(iq)
+		sched.wg.Add(1)
+		go sched.runFollow(iq, &cp)
+	}
+}
+
+// runFollow loads the rows appended to the source file of a follow job every
+// followPollInterval. A stopped job loads the rows appended so far and
+// completes; a cancelled or failed job is not resumed.
+func (sched *QueryScheduler) runFollow(iq *internalQuery, cp *followCheckpoint) {
+	defer sched.wg.Done()
+	defer close(iq.doneChan)
+
+	if !iq.SetRunning(time.Now()) {
+		os.Remove(sched.followCheckpointPath(iq.ID))
+		return
+	}
+
+	ticker := time.NewTicker(followPollInterval)
+	defer ticker.Stop()
+	for {
+		err := sched.followBatch(iq, cp)
+		if err == nil {
+			select {
+			case <-iq.stopFollow:
+				err = sched.followBatch(iq, cp)
+				if err == nil {
+					os.Remove(sched.followCheckpointPath(iq.ID))
+					iq.SetCompleted(time.Now(), QueryResultInner{}, false)
+					return
+				}
+			case <-iq.ctx.Done():
+				// unlike a stop, rows appended since the last micro-batch
+				// are not loaded
+				os.Remove(sched.followCheckpointPath(iq.ID))
+				iq.SetCancelled(time.Now())
+				return
+			case <-sched.stopChan:
+				// resumed from the checkpoint on the next start
+				return
+			case <-ticker.C:
+				continue
+			}
+		}
+
+		os.Remove(sched.followCheckpointPath(iq.ID))
+		iq.SetFailed(time.Now(), &MultipleProblemsError{
+			Problems: []MultipleProblemsErrorProblemsInner{{Error: fmt.Sprintf("failed to follow %s data: %v", iq.QueryDefinition.sourceFormat(), err)}},
+		})
+		return
+	}
+}
+
+// followBatch loads the complete rows appended to the source file since the
+// checkpoint as one micro-batch. The rows are staged and published together
+// with the advanced checkpoint.
+func (sched *QueryScheduler) followBatch(iq *internalQuery, cp *followCheckpoint) error {
+	qd := cp.QueryDefinition
+
+	table, err := sched.ms.GetTableById(cp.TableID)
+	if err != nil {
+		return fmt.Errorf("destination table was dropped")
+	}
+
+	chunk, err := readFollowChunk(qd.SourceFilepath, cp.Offset)
+	if err != nil || len(chunk) == 0 {
+		return err
+	}
+
+	dialect, err := qd.csvDialect()
+	if err != nil {
+		return err
+	}
+	rejects, err := sched.newFollowRejectHandler(iq, cp, dialect)
+	if err != nil {
+		return err
+	}
+	defer rejects.close()
+
+	next := *cp
+	var rows [][]any
+	switch qd.sourceFormat() {
+	case NDJSON:
+		rows, err = sched.parseFollowNDJSON(table, &next, rejects, chunk)
+	default:
+		rows, err = sched.parseFollowCSV(table, &next, rejects, dialect, chunk)
+	}
+	if err == nil {
+		err = rejects.close()
+	}
+	if err != nil {
+		// the job fails, so the rows are not read again
+		for _, problem := range rejects.problems {
+			iq.AddProblem(problem)
+		}
+		return err
+	}
+	if next.Offset == cp.Offset {
+		// the chunk ends inside a CSV record
+		return nil
+	}
+	next.RowsProcessed += int64(len(rows))
+	next.Rejected = rejects.limit.rejected()
+	next.RejectsSize += rejects.written
+
+	state, err := json.Marshal(&next)
+	if err != nil {
+		return err
+	}
+
+	table.AcquireWrite()
+	defer table.ReleaseWrite()
+
+	if current, err := sched.ms.GetTableById(cp.TableID); err != nil || current != table {
+		return fmt.Errorf("destination table was dropped")
+	}
+	// rows inserted before have to precede the appended ones; a memtable is
+	// flushed only when there are such rows, not with every micro-batch
+	if mt := sched.tableMemtable(table); mt != nil && len(mt.rows) != 0 {
+		if err := sched.flushMemtable(table); err != nil {
+			return err
+		}
+	}
+
+	stagedPath := deserializer.StagingPath(sched.dataDir, iq.ID)
+	defer os.RemoveAll(stagedPath)
+	if err := os.MkdirAll(stagedPath, 0755); err != nil {
+		return err
+	}
+	if len(rows) != 0 {
+		if err := sched.stageRows(table, stagedPath, rows); err != nil {
+			return err
+		}
+	}
+	err = deserializer.PublishWithState(sched.wal, filepath.Join(sched.dataDir, table.Name), stagedPath, sched.followCheckpointPath(iq.ID), state)
+	if err != nil {
+		return fmt.Errorf("failed to publish loaded rows: %w", err)
+	}
+
+	*cp = next
+	iq.SetRowsProcessed(cp.RowsProcessed)
+	// reported only now, since the micro-batch of a failed publication is
+	// read again after a restart
+	for _, problem := range rejects.problems {
+		iq.AddProblem(problem)
+	}
+	return nil
+}
+
+// readFollowChunk reads the complete lines of the source file after offset,
+// at most followMaxChunk bytes of them.
+func readFollowChunk(path string, offset int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("source file is not a regular file")
+	}
+	if info.Size() < offset {
+		return nil, fmt.Errorf("source file was truncated below the loaded offset %d", offset)
+	}
+	if info.Size() == offset {
+		return nil, nil
+	}
+
+	if offset == 0 {
+		head := make([]byte, 4)
+		n, _ := file.ReadAt(head, 0)
+		if detectCompression(path, head[:n]) != compressionNone {
+			return nil, fmt.Errorf("compressed source files cannot be followed")
+		}
+	}
+
+	size := info.Size() - offset
+	if size > followMaxChunk {
+		size = followMaxChunk
+	}
+	chunk := make([]byte, size)
+	if _, err := file.ReadAt(chunk, offset); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read source file: %w", err)
+	}
+
+	end := bytes.LastIndexByte(chunk, '\n') + 1
+	if end == 0 && size == followMaxChunk {
+		return nil, fmt.Errorf("line at offset %d is longer than %d bytes", offset, followMaxChunk)
+	}
+	return chunk[:end], nil
+}
+
+// newFollowRejectHandler returns the reject handler of a micro-batch. Rows
+// rejected by earlier micro-batches count against maxErrors and stay in the
+// rejects file; rows written by a micro-batch whose publication did not
+// complete are cut off, so that they are not written twice when it is read
+// again. Problems are reported once the micro-batch is published.
+func (sched *QueryScheduler) newFollowRejectHandler(iq *internalQuery, cp *followCheckpoint, dialect csvDialect) (*rejectHandler, error) {
+	rejects := sched.newRejectHandler(iq, dialect, "", newRejectLimit(iq.QueryDefinition.MaxErrors, cp.Rejected))
+	rejects.append = true
+	rejects.deferred = true
+	if rejects.path != "" {
+		if err := os.Truncate(rejects.path, cp.RejectsSize); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to truncate rejects file: %w", err)
+		}
+	}
+	return rejects, nil
+}
+
+// parseFollowCSV converts the CSV records of a chunk and advances cp past
+// them. Leading rows and the header are consumed by the first chunks. A last
+// record continuing after the chunk is left for the next micro-batch.
+func (sched *QueryScheduler) parseFollowCSV(table *metastore.Table, cp *followCheckpoint, rejects *rejectHandler, dialect csvDialect, chunk []byte) ([][]any, error) {
+	qd := cp.QueryDefinition
+	pos := 0
+	for cp.SkippedRows < dialect.skipRows && pos < len(chunk) {
+		pos += bytes.IndexByte(chunk[pos:], '\n') + 1
+		cp.SkippedRows++
+	}
+	baseLine := cp.Line + bytes.Count(chunk[:pos], []byte{'\n'})
+
+	reader := dialect.csvReader(bufio.NewReader(bytes.NewReader(chunk[pos:])))
+	reader.FieldsPerRecord = -1
+	end := int64(0) // bytes of the chunk after pos consumed by complete records
+
+	// read returns nil at the end of the chunk or when the last record is
+	// not complete yet
+	read := func() ([]string, error) {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) && errors.Is(parseErr.Err, csv.ErrQuote) && reader.InputOffset() == int64(len(chunk)-pos) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV row: %w", err)
+		}
+		end = reader.InputOffset()
+		return record, nil
+	}
+
+	if qd.DoesCsvContainHeader && cp.Header == nil {
+		record, err := read()
+		if err != nil || record == nil {
+			cp.advance(chunk, pos+int(end))
+			return nil, err
+		}
+		cp.Header = make([]string, len(record))
+		for i, name := range record {
+			cp.Header[i] = dialect.field(name)
+		}
+	}
+
+	layout, err := sched.newCSVLayout(qd, table, cp.Header, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows [][]any
+	for {
+		record, err := read()
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		values, err := layout.convert(record, baseLine+line)
+		var rowErr *rowError
+		if errors.As(err, &rowErr) {
+			if err := rejects.reject(rowErr); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, values)
+	}
+
+	cp.advance(chunk, pos+int(end))
+	return rows, nil
+}
+
+// parseFollowNDJSON converts the lines of a chunk and advances cp past them.
+func (sched *QueryScheduler) parseFollowNDJSON(table *metastore.Table, cp *followCheckpoint, rejects *rejectHandler, chunk []byte) ([][]any, error) {
+	src, err := sched.newNDJSONRowSource(cp.QueryDefinition, table, bytes.NewReader(chunk))
+	if err != nil {
+		return nil, err
+	}
+	src.line = cp.Line
+
+	var rows [][]any
+	for {
+		values, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *rowError
+		if errors.As(err, &rowErr) {
+			if err := rejects.reject(rowErr); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, values)
+	}
+
+	cp.advance(chunk, len(chunk))
+	return rows, nil
+}
+
+// advance moves the checkpoint past the first n bytes of chunk.
+func (cp *followCheckpoint) advance(chunk []byte, n int) {
+	cp.Offset += int64(n)
+	cp.Line += bytes.Count(chunk[:n], []byte{'\n'})
+}
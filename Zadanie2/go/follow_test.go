@@ -0,0 +1,291 @@
+package openapi
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// appendTestFile appends content to a file.
+func appendTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitRowsProcessed waits until a running query has processed rows rows.
+func (ts *testServer) waitRowsProcessed(id string, rows int64) *internalQuery {
+	ts.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		iq, ok := ts.service.qs.get(id)
+		if ok && iq.GetRowsProcessed() >= rows {
+			return iq
+		}
+		if ok && iq.GetStatus() != RUNNING && iq.GetStatus() != CREATED {
+			ts.t.Fatalf("query ended %s: %s", iq.GetStatus(), problemsOf(iq))
+		}
+		if time.Now().After(deadline) {
+			ts.t.Fatalf("query %s did not process %d rows", id, rows)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestShutdownStopsFollowJobBetweenMicroBatches(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "1\n2\n")
+	id := ts.submit(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", Follow: true})
+	iq := ts.waitRowsProcessed(id, 2)
+
+	appendTestFile(t, src, "3\n")
+	ts.stop()
+	select {
+	case <-iq.doneChan:
+	default:
+		t.Fatal("follow job still runs after shutdown")
+	}
+	if status := iq.GetStatus(); status != RUNNING {
+		t.Errorf("follow job ended %s on shutdown, want it left to be resumed", status)
+	}
+	checkpoint := filepath.Join(ts.dataDir(), followDir, id+".json")
+	if _, err := os.Stat(checkpoint); err != nil {
+		t.Fatalf("checkpoint removed on shutdown: %v", err)
+	}
+
+	// the resumed job loads every row exactly once
+	ts.start()
+	ts.waitRowsProcessed(id, 3)
+	want := [][]any{{int64(1)}, {int64(2)}, {int64(3)}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+}
+
+func TestFailedFollowStartLeavesNoQuery(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "1\n")
+	// the checkpoint directory cannot be created
+	writeTestFile(t, ts.dataDir(), followDir, "")
+
+	response, err := ts.service.SubmitQuery(context.Background(), ExecuteQueryRequest{
+		QueryDefinition: QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", Follow: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != http.StatusInternalServerError {
+		t.Fatalf("follow job started: %d %v", response.Code, response.Body)
+	}
+	if queries := ts.service.qs.list(); len(queries) != 0 {
+		t.Errorf("failed follow job left %d queries", len(queries))
+	}
+}
+
+func TestFollowKeepsInsertedRowsInOrder(t *testing.T) {
+	ts := newTestServer(t)
+	tableID := ts.createTable("t", intColumn("id"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "1\n")
+	id := ts.submit(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", Follow: true})
+	ts.waitRowsProcessed(id, 1)
+
+	// the inserted row is flushed by the next micro-batch, ahead of the
+	// appended one
+	ts.insertAndWait(tableID, `[[2]]`)
+	appendTestFile(t, src, "3\n")
+	ts.waitRowsProcessed(id, 2)
+	if n := ts.bufferedRows("t"); n != 0 {
+		t.Errorf("memtable holds %d rows after the micro-batch", n)
+	}
+	ts.insertAndWait(tableID, `[[4]]`)
+
+	want := [][]any{{int64(1)}, {int64(2)}, {int64(3)}, {int64(4)}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+}
+
+func TestStopFollowJob(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "1\n")
+	id := ts.submit(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", Follow: true})
+	ts.waitRowsProcessed(id, 1)
+
+	// rows appended before the stop are loaded by the stopping job
+	appendTestFile(t, src, "2\n3\n")
+	if recorder := ts.serve(http.MethodPost, "/query/"+id+"/stop", "", nil); recorder.Code != http.StatusAccepted {
+		t.Fatalf("stop answered %d: %s", recorder.Code, recorder.Body)
+	}
+	iq := ts.wait(id)
+	if iq.GetStatus() != COMPLETED || iq.GetRowsProcessed() != 3 {
+		t.Fatalf("follow job ended %s with %d rows: %s", iq.GetStatus(), iq.GetRowsProcessed(), problemsOf(iq))
+	}
+	want := [][]any{{int64(1)}, {int64(2)}, {int64(3)}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(ts.dataDir(), followDir, id+".json")); !os.IsNotExist(err) {
+		t.Errorf("checkpoint of a stopped job left behind: %v", err)
+	}
+
+	// a stopped job is not resumed
+	ts.restart()
+	if _, ok := ts.service.qs.get(id); ok {
+		t.Error("stopped follow job resumed after restart")
+	}
+
+	other := ts.submit(QueryQueryDefinition{TableName: "t"})
+	if recorder := ts.serve(http.MethodPost, "/query/"+other+"/stop", "", nil); recorder.Code != http.StatusBadRequest {
+		t.Errorf("stopping a SELECT answered %d", recorder.Code)
+	}
+}
+
+func TestFollowLoadsOnlyCompleteRows(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"), stringColumn("name"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "id,name\n1,a\n2,\"multi\n")
+	id := ts.submit(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", DoesCsvContainHeader: true, Follow: true})
+	ts.waitRowsProcessed(id, 1)
+
+	// the quoted field and the last line are completed later
+	appendTestFile(t, src, "line\"\n3,c")
+	ts.waitRowsProcessed(id, 2)
+	appendTestFile(t, src, "\n")
+	ts.serve(http.MethodPost, "/query/"+id+"/stop", "", nil)
+	if iq := ts.wait(id); iq.GetStatus() != COMPLETED {
+		t.Fatalf("follow job ended %s: %s", iq.GetStatus(), problemsOf(iq))
+	}
+
+	want := [][]any{{int64(1), "a"}, {int64(2), "multi\nline"}, {int64(3), "c"}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+}
+
+func TestFollowNDJSON(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"), stringColumn("name"))
+	src := writeTestFile(t, t.TempDir(), "t.ndjson", `{"id": 1, "name": "a"}`+"\n")
+	id := ts.submit(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", SourceFormat: NDJSON, Follow: true})
+	ts.waitRowsProcessed(id, 1)
+
+	appendTestFile(t, src, `{"id": 2, "name": "b"}`+"\n")
+	ts.serve(http.MethodPost, "/query/"+id+"/stop", "", nil)
+	ts.wait(id)
+
+	want := [][]any{{int64(1), "a"}, {int64(2), "b"}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+}
+
+func TestFollowCountsRejectsOverMicroBatches(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "t.csv", "1\nx\n")
+	rejectsPath := filepath.Join(dir, "bad.csv")
+	id := ts.submit(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", MaxErrors: 1, RejectsFilepath: rejectsPath, Follow: true})
+	ts.waitRowsProcessed(id, 1)
+
+	// the job resumed after a restart still counts the first rejected row
+	ts.restart()
+	appendTestFile(t, src, "y\n")
+	iq := ts.wait(id)
+	if iq.GetStatus() != FAILED {
+		t.Fatalf("follow job ended %s, want FAILED", iq.GetStatus())
+	}
+	if problems := problemsOf(iq); !strings.Contains(problems, "exceeds maxErrors (1)") {
+		t.Errorf("problems %q do not mention maxErrors", problems)
+	}
+	if rejects, err := os.ReadFile(rejectsPath); err != nil || string(rejects) != "x\ny\n" {
+		t.Errorf("rejects file holds %q, %v", rejects, err)
+	}
+	if got, want := ts.selectRows("t"), [][]any{{int64(1)}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+}
+
+func TestFollowFails(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(ts *testServer, tableID, src string)
+		problem string
+	}{
+		{
+			name: "dropped table",
+			change: func(ts *testServer, tableID, src string) {
+				ts.service.DeleteTable(context.Background(), tableID)
+			},
+			problem: "destination table was dropped",
+		},
+		{
+			name: "truncated file",
+			change: func(ts *testServer, tableID, src string) {
+				if err := os.Truncate(src, 1); err != nil {
+					t.Fatal(err)
+				}
+			},
+			problem: "truncated below the loaded offset",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			tableID := ts.createTable("t", intColumn("id"))
+			src := writeTestFile(t, t.TempDir(), "t.csv", "1\n2\n")
+			id := ts.submit(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", Follow: true})
+			ts.waitRowsProcessed(id, 2)
+
+			test.change(ts, tableID, src)
+			iq := ts.wait(id)
+			if iq.GetStatus() != FAILED {
+				t.Fatalf("follow job ended %s, want FAILED", iq.GetStatus())
+			}
+			if problems := problemsOf(iq); !strings.Contains(problems, test.problem) {
+				t.Errorf("problems %q do not mention %q", problems, test.problem)
+			}
+			if _, err := os.Stat(filepath.Join(ts.dataDir(), followDir, id+".json")); !os.IsNotExist(err) {
+				t.Errorf("checkpoint of a failed job left behind: %v", err)
+			}
+		})
+	}
+}
+
+func TestFollowRejectsInvalidQueries(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "t.csv", "1\n")
+
+	for _, qd := range []QueryQueryDefinition{
+		{SourceFilepath: filepath.Join(dir, "*.csv"), DestinationTableName: "t", Follow: true},
+		{SourceFilepath: src, DestinationTableName: "t", MergeKeyColumns: []string{"id"}, Follow: true},
+		{SourceFilepath: src, DestinationTableName: "t", SourceFormat: PARQUET, Follow: true},
+	} {
+		ts.rejected(qd)
+	}
+
+	gz := filepath.Join(dir, "t.csv.gz")
+	if err := os.WriteFile(gz, compressTestData(t, compressionGzip, "1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	problems := ts.mustFail(QueryQueryDefinition{SourceFilepath: gz, DestinationTableName: "t", Follow: true})
+	if !strings.Contains(problems, "compressed source files cannot be followed") {
+		t.Errorf("problems %q do not mention compression", problems)
+	}
+}
@@ -139,6 +139,24 @@ func ReadFormFilesToTempFiles(r *http.Request, key string) ([]*os.File, error) {
 	return files, nil
 }
 
+// ReadBodyToTempFile streams the request body (which may use chunked transfer encoding) to a temporary file
+func ReadBodyToTempFile(r *http.Request) (*os.File, error) {
+	file, err := os.CreateTemp("", "upload.*")
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	_, err = io.Copy(file, r.Body)
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	return file, nil
+}
+
 // readFileHeaderToTempFile reads multipart.FileHeader and writes it to a temporary file
 func readFileHeaderToTempFile(fileHeader *multipart.FileHeader) (*os.File, error) {
 	formFile, err := fileHeader.Open()
@@ -0,0 +1,140 @@
+package openapi
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// defaultSampleRows is the number of rows column types are inferred from when
+// the request does not set it.
+const defaultSampleRows = 1000
+
+// inferableTypes are tried in order for every column; the column gets the
+// first type all its sampled values parse as, VARCHAR if there is none.
+var inferableTypes = []struct {
+	typ    LogicalColumnType
+	parses func(string) bool
+}{
+	{INT64, func(s string) bool {
+		_, err := strconv.ParseInt(s, 10, 64)
+		return err == nil
+	}},
+}
+
+// copyQuery returns the COPY query loading the source file of the request
+// into the created table.
+func (req InferTableRequest) copyQuery() QueryQueryDefinition {
+	return QueryQueryDefinition{
+		SourceFilepath:       req.SourceFilepath,
+		DestinationTableName: req.TableName,
+		DoesCsvContainHeader: req.DoesCsvContainHeader,
+		Delimiter:            req.Delimiter,
+		QuoteChar:            req.QuoteChar,
+		EscapeChar:           req.EscapeChar,
+		NullMarker:           req.NullMarker,
+		SkipRows:             req.SkipRows,
+		CommentPrefix:        req.CommentPrefix,
+		TrimSpaces:           req.TrimSpaces,
+		LazyQuotes:           req.LazyQuotes,
+		MaxErrors:            req.MaxErrors,
+		RejectsFilepath:      req.RejectsFilepath,
+	}
+}
+
+// inferCSVSchema reads up to sampleRows rows of the CSV source of a COPY
+// query and returns the columns of a table they fit. Column names come from
+// the header; columns in which the null marker appears are nullable.
+func inferCSVSchema(qd QueryQueryDefinition, sampleRows int) ([]Column, error) {
+	dialect, err := qd.csvDialect()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := openSource(qd.SourceFilepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer file.Close()
+
+	reader, err := dialect.newReader(file)
+	if err != nil {
+		return nil, err
+	}
+	// rows with a different number of fields are rejected by the load, they
+	// only must not stop the sampling
+	reader.FieldsPerRecord = -1
+
+	var names []string
+	if qd.DoesCsvContainHeader {
+		names, err = readCSVHeader(reader, dialect)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var candidates [][]bool // per column, whether every value parsed as inferableTypes[i]
+	var nullable []bool
+	for n := 0; n < sampleRows; n++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV row: %w", err)
+		}
+		if names == nil {
+			names = make([]string, len(record))
+		}
+		if candidates == nil {
+			candidates = make([][]bool, len(names))
+			for i := range candidates {
+				candidates[i] = make([]bool, len(inferableTypes))
+				for t := range inferableTypes {
+					candidates[i][t] = true
+				}
+			}
+			nullable = make([]bool, len(names))
+		}
+
+		for i, raw := range record {
+			if i >= len(names) {
+				break
+			}
+			value := dialect.field(raw)
+			if dialect.isNull(value) {
+				nullable[i] = true
+				continue
+			}
+			for t, inferable := range inferableTypes {
+				if candidates[i][t] && !inferable.parses(value) {
+					candidates[i][t] = false
+				}
+			}
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("cannot infer columns of an empty CSV file")
+	}
+
+	columns := make([]Column, len(names))
+	for i, name := range names {
+		if name == "" {
+			name = fmt.Sprintf("column%d", i+1)
+		}
+		columns[i] = Column{Name: name, Type: VARCHAR}
+		if candidates == nil {
+			// header only, nothing to infer types from
+			continue
+		}
+		for t, inferable := range inferableTypes {
+			if candidates[i][t] {
+				columns[i].Type = inferable.typ
+				break
+			}
+		}
+		columns[i].Nullable = nullable[i]
+	}
+	return columns, nil
+}
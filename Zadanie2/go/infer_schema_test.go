@@ -0,0 +1,110 @@
+package openapi
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInferCSVSchema(t *testing.T) {
+	dir := t.TempDir()
+	nullableInt := intColumn("score")
+	nullableInt.Nullable = true
+	tests := []struct {
+		name    string
+		query   QueryQueryDefinition
+		content string
+		want    []Column
+	}{
+		{
+			name:    "header",
+			query:   QueryQueryDefinition{DoesCsvContainHeader: true, NullMarker: "NA"},
+			content: "id,name,score\n1,a,10\n-2,3x,NA\n",
+			want:    []Column{intColumn("id"), stringColumn("name"), nullableInt},
+		},
+		{
+			name:    "no header",
+			query:   QueryQueryDefinition{Delimiter: ";"},
+			content: "1;x\n2;y\n",
+			want:    []Column{intColumn("column1"), stringColumn("column2")},
+		},
+		{
+			name:    "empty header name",
+			query:   QueryQueryDefinition{DoesCsvContainHeader: true},
+			content: "id,\n1,2\n",
+			want:    []Column{intColumn("id"), intColumn("column2")},
+		},
+		{
+			// values beyond the sample do not change the types
+			name:    "sample",
+			query:   QueryQueryDefinition{},
+			content: "1\n2\nx\n",
+			want:    []Column{intColumn("column1")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.query.SourceFilepath = writeTestFile(t, dir, "t.csv", test.content)
+			columns, err := inferCSVSchema(test.query, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(columns, test.want) {
+				t.Errorf("inferred %v, want %v", columns, test.want)
+			}
+		})
+	}
+
+	if _, err := inferCSVSchema(QueryQueryDefinition{SourceFilepath: writeTestFile(t, dir, "empty.csv", "")}, 10); err == nil {
+		t.Error("columns inferred from an empty file")
+	}
+}
+
+func TestInferTableCreatesAndLoadsTable(t *testing.T) {
+	ts := newTestServer(t)
+	src := writeTestFile(t, t.TempDir(), "t.csv", "id,name\n1,a\n2,b\nx,c\n")
+
+	response, err := ts.service.InferTable(context.Background(), InferTableRequest{
+		TableName:            "t",
+		SourceFilepath:       src,
+		DoesCsvContainHeader: true,
+		SampleRows:           2,
+		MaxErrors:            1,
+	})
+	if err != nil || response.Code != http.StatusOK {
+		t.Fatalf("failed to infer table: %v %v", response.Body, err)
+	}
+	inferred := response.Body.(InferredTable)
+	if want := []Column{intColumn("id"), stringColumn("name")}; !reflect.DeepEqual(inferred.Columns, want) {
+		t.Errorf("inferred %v, want %v", inferred.Columns, want)
+	}
+
+	iq := ts.wait(inferred.QueryId)
+	if iq.GetStatus() != COMPLETED {
+		t.Fatalf("load ended %s: %s", iq.GetStatus(), problemsOf(iq))
+	}
+	// the row beyond the sample does not fit the inferred type
+	if problems := problemsOf(iq); !strings.Contains(problems, "line 4") {
+		t.Errorf("problems %q do not mention the rejected row", problems)
+	}
+	want := [][]any{{int64(1), "a"}, {int64(2), "b"}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+}
+
+func TestInferTableRejectsExistingTable(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "1\n")
+
+	response, err := ts.service.InferTable(context.Background(), InferTableRequest{TableName: "t", SourceFilepath: src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("table inferred over an existing one: %d %v", response.Code, response.Body)
+	}
+}
@@ -0,0 +1,115 @@
+package openapi
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+type compression int
+
+const (
+	compressionNone compression = iota
+	compressionGzip
+	compressionZstd
+	compressionBzip2
+	compressionLZ4
+)
+
+var compressionMagic = []struct {
+	magic       []byte
+	compression compression
+}{
+	{[]byte{0x1f, 0x8b}, compressionGzip},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, compressionZstd},
+	{[]byte("BZh"), compressionBzip2},
+	{[]byte{0x04, 0x22, 0x4d, 0x18}, compressionLZ4},
+}
+
+var compressionExtensions = map[string]compression{
+	".gz":   compressionGzip,
+	".gzip": compressionGzip,
+	".zst":  compressionZstd,
+	".zstd": compressionZstd,
+	".bz2":  compressionBzip2,
+	".lz4":  compressionLZ4,
+}
+
+// detectCompression recognizes the compression by the magic bytes at the
+// beginning of the file and falls back to the file extension.
+func detectCompression(path string, head []byte) compression {
+	for _, m := range compressionMagic {
+		if !bytes.HasPrefix(head, m.magic) {
+			continue
+		}
+		// "BZh" alone may well start a plain text file; it is followed by
+		// the block size digit
+		if m.compression == compressionBzip2 && (len(head) < 4 || head[3] < '1' || head[3] > '9') {
+			continue
+		}
+		return m.compression
+	}
+	return compressionExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// sourceReader is a source file with a decompressor (if any) on top of it.
+type sourceReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (s *sourceReader) Close() error {
+	var firstErr error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if err := s.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// openSource opens a COPY source file. gzip, zstd, bzip2 and LZ4-framed files
+// are decompressed on the fly.
+func openSource(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(file)
+	head, _ := br.Peek(4)
+	src := &sourceReader{Reader: br, closers: []io.Closer{file}}
+
+	switch detectCompression(path, head) {
+	case compressionGzip:
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		src.Reader = gz
+		src.closers = append(src.closers, gz)
+	case compressionZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to open zstd stream: %w", err)
+		}
+		src.Reader = zr
+		src.closers = append(src.closers, zr.IOReadCloser())
+	case compressionBzip2:
+		src.Reader = bzip2.NewReader(br)
+	case compressionLZ4:
+		src.Reader = lz4.NewReader(br)
+	}
+	return src, nil
+}
@@ -0,0 +1,126 @@
+package openapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+func TestDetectCompression(t *testing.T) {
+	tests := []struct {
+		path string
+		head string
+		want compression
+	}{
+		{"t.csv", "\x1f\x8b\x08\x00", compressionGzip},
+		{"t.csv", "\x28\xb5\x2f\xfd", compressionZstd},
+		{"t.csv", "BZh9", compressionBzip2},
+		{"t.csv", "\x04\x22\x4d\x18", compressionLZ4},
+		{"t.csv", "BZh,1\n", compressionNone},
+		{"t.csv", "BZh", compressionNone},
+		{"t.csv", "id,name\n", compressionNone},
+		{"t.csv.gz", "id,name\n", compressionGzip},
+		{"t.CSV.BZ2", "", compressionBzip2},
+		{"t.csv.zst", "\x1f\x8b", compressionGzip},
+	}
+	for _, tt := range tests {
+		if got := detectCompression(tt.path, []byte(tt.head)); got != tt.want {
+			t.Errorf("detectCompression(%q, %q) = %v, want %v", tt.path, tt.head, got, tt.want)
+		}
+	}
+}
+
+// bzip2Rows is "1,a\n2,b\n" compressed by bzip2, which has no encoder in the
+// standard library.
+const bzip2Rows = "QlpoOTFBWSZTWbCnEU8AAAJZAAAQAAQwADAAIAAhppmgwAKVCwu5IpwoSFhTiKeA"
+
+func compressTestData(t *testing.T, c compression, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch c {
+	case compressionGzip:
+		w = gzip.NewWriter(&buf)
+	case compressionZstd:
+		w, err = zstd.NewWriter(&buf)
+	case compressionLZ4:
+		w = lz4.NewWriter(&buf)
+	case compressionBzip2:
+		data, err := base64.StdEncoding.DecodeString(bzip2Rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoadCompressedSource(t *testing.T) {
+	tests := []struct {
+		table       string
+		name        string
+		compression compression
+	}{
+		{"gzip", "t.csv.gz", compressionGzip},
+		{"zstd", "t.csv.zst", compressionZstd},
+		{"bzip2", "t.csv.bz2", compressionBzip2},
+		{"lz4", "t.csv.lz4", compressionLZ4},
+		// detected by the magic bytes
+		{"gzip_magic", "t.csv", compressionGzip},
+		{"lz4_magic", "t.data", compressionLZ4},
+	}
+
+	ts := newTestServer(t)
+	for _, tt := range tests {
+		t.Run(tt.table, func(t *testing.T) {
+			ts.createTable(tt.table, intColumn("id"), stringColumn("name"))
+			data := compressTestData(t, tt.compression, "1,a\n2,b\n")
+			src := writeTestFile(t, t.TempDir(), tt.name, string(data))
+
+			ts.mustComplete(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: tt.table})
+			want := [][]any{{int64(1), "a"}, {int64(2), "b"}}
+			if got := ts.selectRows(tt.table); !reflect.DeepEqual(got, want) {
+				t.Errorf("table holds %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestLoadPlainFileStartingWithBZh(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", stringColumn("name"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "BZh\nBZh,x\n")
+
+	ts.mustComplete(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", MaxErrors: 1})
+	want := [][]any{{"BZh"}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+}
+
+func TestLoadCorruptCompressedSourceFails(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	src := writeTestFile(t, t.TempDir(), "t.csv.gz", "\x1f\x8b not really gzip")
+
+	ts.mustFail(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t"})
+	if got := ts.selectRows("t"); len(got) != 0 {
+		t.Errorf("failed load left rows %v", got)
+	}
+}
@@ -0,0 +1,162 @@
+package openapi
+
+import (
+	"Zadanie2/deserializer"
+	"Zadanie2/metastore"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// parseInsertRows converts the rows of an insert request to table values.
+// A row is either an array holding a value for every table column in order,
+// or an object keyed by column name in which columns having a default value
+// or being nullable may be left out. Every invalid row is reported as a
+// problem; rows are returned only if there is none.
+func (sched *QueryScheduler) parseInsertRows(table *metastore.Table, rows []interface{}) ([][]any, []MultipleProblemsErrorProblemsInner, error) {
+	// any column may be absent from an object
+	fill, missing, err := sched.columnFill(table, map[int]int{})
+	if err != nil {
+		return nil, nil, err
+	}
+	fillable := make([]bool, len(table.Columns))
+	for idx := range fillable {
+		fillable[idx] = true
+	}
+	for _, name := range missing {
+		fillable[table.ColumnMapping[name]] = false
+	}
+
+	var problems []MultipleProblemsErrorProblemsInner
+	report := func(rowIdx int, column string, err error) {
+		context := fmt.Sprintf("row %d", rowIdx+1)
+		if column != "" {
+			context += fmt.Sprintf(", column '%s'", column)
+		}
+		problems = append(problems, MultipleProblemsErrorProblemsInner{Error: err.Error(), Context: context})
+	}
+
+	values := make([][]any, 0, len(rows))
+	for rowIdx, row := range rows {
+		rowValues := make([]any, len(table.Columns))
+		valid := true
+
+		switch r := row.(type) {
+		case []interface{}:
+			if len(r) != len(table.Columns) {
+				report(rowIdx, "", fmt.Errorf("row has %d values but table has %d columns", len(r), len(table.Columns)))
+				continue
+			}
+			for idx, col := range table.Columns {
+				parsed, err := jsonValue(r[idx], col)
+				if err != nil {
+					report(rowIdx, col.Name, err)
+					valid = false
+					continue
+				}
+				rowValues[idx] = parsed
+			}
+		case map[string]interface{}:
+			var unknown []string
+			for name := range r {
+				if _, ok := table.ColumnMapping[name]; !ok {
+					unknown = append(unknown, name)
+				}
+			}
+			if len(unknown) != 0 {
+				sort.Strings(unknown)
+				report(rowIdx, "", fmt.Errorf("unknown columns: %s", strings.Join(unknown, ", ")))
+				continue
+			}
+			for idx, col := range table.Columns {
+				val, found := r[col.Name]
+				if !found {
+					if !fillable[idx] {
+						report(rowIdx, col.Name, fmt.Errorf("missing value for column '%s'", col.Name))
+						valid = false
+					}
+					rowValues[idx] = fill[idx]
+					continue
+				}
+				parsed, err := jsonValue(val, col)
+				if err != nil {
+					report(rowIdx, col.Name, err)
+					valid = false
+					continue
+				}
+				rowValues[idx] = parsed
+			}
+		default:
+			report(rowIdx, "", fmt.Errorf("row is neither a JSON array nor a JSON object"))
+			continue
+		}
+
+		if valid {
+			values = append(values, rowValues)
+		}
+	}
+
+	if len(problems) != 0 {
+		return nil, problems, nil
+	}
+	return values, nil, nil
+}
+
+func (sched *QueryScheduler) executeInsert(iq *internalQuery) error {
+	// looked up by ID, so a table recreated under the same name in the
+	// meantime does not receive rows validated against another schema
+	table, err := sched.ms.GetTableById(iq.TableID)
+	if err != nil {
+		return err
+	}
+
+	table.AcquireWrite()
+	defer table.ReleaseWrite()
+
+	// the table may have been dropped while waiting for the lock, its
+	// memtable is discarded already
+	if current, err := sched.ms.GetTableById(table.ID); err != nil || current != table {
+		return fmt.Errorf("table was dropped")
+	}
+
+	rows := iq.takeInsertRows()
+	if err := iq.checkCancelled(); err != nil {
+		return err
+	}
+	if err := sched.bufferRows(table, rows); err != nil {
+		return fmt.Errorf("failed to insert rows: %w", err)
+	}
+	iq.SetRowsProcessed(int64(len(rows)))
+	return nil
+}
+
+// stageRows writes rows of the table as batches of column files in path.
+func (sched *QueryScheduler) stageRows(table *metastore.Table, path string, rows [][]any) error {
+	serialize, err := deserializer.NewSerializer(path, deserializer.BatchSize, int32(len(table.Columns)))
+	if err != nil {
+		return fmt.Errorf("failed to create serializer: %w", err)
+	}
+	serialize.SetDurability(sched.durability)
+
+	builder := newBatchBuilder(table)
+	numBatches := 0
+	flush := func() error {
+		if err := serialize.WriteBatch(numBatches, builder.build()); err != nil {
+			return fmt.Errorf("failed to write batch file: %w", err)
+		}
+		numBatches++
+		return nil
+	}
+	for _, values := range rows {
+		builder.appendRow(values)
+		if builder.numRows == deserializer.BatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if builder.numRows > 0 {
+		return flush()
+	}
+	return nil
+}
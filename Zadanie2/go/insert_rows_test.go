@@ -0,0 +1,81 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// insertRows posts rows given as JSON to the table.
+func (ts *testServer) insertRows(tableID, rows string) (int, string) {
+	ts.t.Helper()
+	recorder := ts.serve(http.MethodPost, "/table/"+tableID+"/rows", "application/json", strings.NewReader(rows))
+	return recorder.Code, recorder.Body.String()
+}
+
+func TestInsertRows(t *testing.T) {
+	ts := newTestServer(t)
+	name := stringColumn("name")
+	name.Nullable = true
+	score := intColumn("score")
+	zero := "0"
+	score.Default = &zero
+	tableID := ts.createTable("t", intColumn("id"), name, score)
+
+	code, body := ts.insertRows(tableID, `[[1, "a", 10], {"id": 2, "name": "b"}, {"id": 3, "score": 30}, [4, null, 40]]`)
+	if code != http.StatusOK {
+		t.Fatalf("insert failed: %d %s", code, body)
+	}
+	var queryID string
+	if err := json.Unmarshal([]byte(body), &queryID); err != nil {
+		t.Fatal(err)
+	}
+	iq := ts.wait(queryID)
+	if iq.GetStatus() != COMPLETED || iq.GetRowsProcessed() != 4 {
+		t.Fatalf("insert ended %s with %d rows: %s", iq.GetStatus(), iq.GetRowsProcessed(), problemsOf(iq))
+	}
+
+	want := [][]any{
+		{int64(1), "a", int64(10)},
+		{int64(2), "b", int64(0)},
+		{int64(3), nil, int64(30)},
+		{int64(4), nil, int64(40)},
+	}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+}
+
+func TestInsertRowsReportsAllInvalidRows(t *testing.T) {
+	ts := newTestServer(t)
+	tableID := ts.createTable("t", intColumn("id"), stringColumn("name"))
+
+	code, body := ts.insertRows(tableID, `[[1, "a"], [2], {"id": "x", "name": "c"}, {"id": 4, "nick": "d"}, {"name": "e"}, "f"]`)
+	if code != http.StatusBadRequest {
+		t.Fatalf("invalid rows accepted: %d %s", code, body)
+	}
+	var problems MultipleProblemsError
+	if err := json.Unmarshal([]byte(body), &problems); err != nil {
+		t.Fatal(err)
+	}
+	var contexts []string
+	for _, problem := range problems.Problems {
+		contexts = append(contexts, problem.Context)
+	}
+	want := []string{"row 2", "row 3, column 'id'", "row 4", "row 5, column 'id'", "row 6"}
+	if !reflect.DeepEqual(contexts, want) {
+		t.Errorf("problems in %v, want %v", contexts, want)
+	}
+	if got := ts.selectRows("t"); len(got) != 0 {
+		t.Errorf("rejected insert left rows %v", got)
+	}
+}
+
+func TestInsertRowsIntoMissingTable(t *testing.T) {
+	ts := newTestServer(t)
+	if code, body := ts.insertRows("missing", `[[1]]`); code != http.StatusNotFound {
+		t.Errorf("insert into a missing table: %d %s", code, body)
+	}
+}
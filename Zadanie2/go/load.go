@@ -0,0 +1,244 @@
+package openapi
+
+import (
+	"Zadanie2/deserializer"
+	"Zadanie2/metastore"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// rowSource produces the rows of a COPY source file.
+type rowSource interface {
+	// next returns the values of the next row indexed by table column, or
+	// io.EOF after the last row. A *rowError is returned for a row which has
+	// to be rejected; reading may continue after it.
+	next() ([]any, error)
+}
+
+// rowError describes a source row which cannot be loaded.
+type rowError struct {
+	line   int
+	row    int      // row number in sources without lines (Parquet)
+	column string   // table column, empty when the problem concerns the whole row
+	record []string // fields of a CSV row
+	raw    string   // the row as read from a line-based source other than CSV
+	err    error
+}
+
+func (e *rowError) Error() string {
+	return e.err.Error()
+}
+
+func (query QueryQueryDefinition) sourceFormat() SourceFormat {
+	if query.SourceFormat == "" {
+		return CSV
+	}
+	return query.SourceFormat
+}
+
+// loadData loads the COPY source into the table. A source path naming a
+// directory or a glob pattern is expanded into many files, see loadFiles.
+//
+// A load is atomic: batches are written to a staging directory and appended
+// to the table files only after the whole source has been loaded, so a failed
+// load leaves the table unchanged. A load with merge key columns is merged
+// into the table instead, see mergeStaged.
+func (sched *QueryScheduler) loadData(iq *internalQuery, table *metastore.Table) (int, error) {
+	qd := iq.QueryDefinition
+
+	paths, expanded, err := expandSourcePaths(qd.SourceFilepath)
+	if err != nil {
+		return 0, err
+	}
+
+	var keyIdx []int
+	if len(qd.MergeKeyColumns) != 0 {
+		keyIdx, err = mergeKeyIndices(table, qd.MergeKeyColumns)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	stagedPath := deserializer.StagingPath(sched.dataDir, iq.ID)
+	defer os.RemoveAll(stagedPath)
+
+	writer, err := sched.newTableWriter(iq, table, stagedPath)
+	if err != nil {
+		return 0, err
+	}
+
+	limit := newRejectLimit(qd.MaxErrors, 0)
+	var rowCount int
+	if !expanded {
+		rowCount, err = sched.loadFile(iq, table, qd.SourceFilepath, writer, "", limit, nil)
+	} else {
+		rowCount, err = sched.loadFiles(iq, table, paths, writer, limit)
+	}
+	if err != nil {
+		return rowCount, err
+	}
+	// a load cancelled up to here is rolled back by not publishing it
+	if err := iq.checkCancelled(); err != nil {
+		return rowCount, err
+	}
+
+	if keyIdx != nil {
+		if err := sched.mergeStaged(iq, table, stagedPath, keyIdx); err != nil {
+			return rowCount, fmt.Errorf("failed to merge loaded rows: %w", err)
+		}
+		return rowCount, nil
+	}
+	if err := deserializer.PublishStaged(sched.wal, filepath.Join(sched.dataDir, table.Name), stagedPath); err != nil {
+		return rowCount, fmt.Errorf("failed to publish loaded rows: %w", err)
+	}
+	return rowCount, nil
+}
+
+// tableWriter appends batches to the staged files of a load and publishes the
+// number of rows written so far on the query. It is shared by all files of a
+// multi-file load, which may be loaded in parallel.
+type tableWriter struct {
+	mu         sync.Mutex
+	iq         *internalQuery
+	serialize  *deserializer.Serializer
+	numBatches int
+	rowCount   int64
+}
+
+func (sched *QueryScheduler) newTableWriter(iq *internalQuery, table *metastore.Table, path string) (*tableWriter, error) {
+	serialize, err := deserializer.NewSerializer(path, deserializer.BatchSize, int32(len(table.Columns)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create serializer: %w", err)
+	}
+	serialize.SetDurability(sched.durability)
+	return &tableWriter{iq: iq, serialize: serialize}, nil
+}
+
+func (w *tableWriter) write(batch *deserializer.Batch) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.iq.checkCancelled(); err != nil {
+		return err
+	}
+
+	if err := w.serialize.WriteBatch(w.numBatches, batch); err != nil {
+		return fmt.Errorf("failed to write batch file: %w", err)
+	}
+	w.numBatches++
+	w.rowCount += int64(batch.BatchSize)
+	w.iq.SetRowsProcessed(w.rowCount)
+	return nil
+}
+
+// loadFile streams a single source file (decompressing it if needed) into
+// the table one batch at a time, so memory use does not depend on the file
+// size. label names the file in reported problems of a multi-file load;
+// limit counts its rejected rows together with the other files; progress, if set, is called with the number of rows of the file written so
+// far.
+func (sched *QueryScheduler) loadFile(
+	iq *internalQuery,
+	table *metastore.Table,
+	path string,
+	writer *tableWriter,
+	label string,
+	limit *rejectLimit,
+	progress func(rows int64),
+) (int, error) {
+	qd := iq.QueryDefinition
+
+	dialect, err := qd.csvDialect()
+	if err != nil {
+		return 0, err
+	}
+
+	var src rowSource
+	if qd.sourceFormat() == PARQUET {
+		// Parquet needs random access to its footer and compresses its pages
+		// itself, so the file is not passed through openSource
+		parquetSrc, err := sched.newParquetRowSource(table, path)
+		if err != nil {
+			return 0, err
+		}
+		defer parquetSrc.close()
+		src = parquetSrc
+	} else {
+		file, err := openSource(path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open source file: %w", err)
+		}
+		defer file.Close()
+
+		switch {
+		case qd.sourceFormat() == NDJSON:
+			src, err = sched.newNDJSONRowSource(qd, table, file)
+		case dialect.parallelizable() && sched.scanPool.size > 1:
+			var csvSrc *parallelCSVRowSource
+			csvSrc, err = sched.newParallelCSVRowSource(qd, table, file, dialect)
+			if err == nil {
+				defer csvSrc.close()
+				src = csvSrc
+			}
+		default:
+			src, err = sched.newCSVRowSource(qd, table, file, dialect)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	rowCount := 0
+
+	rejects := sched.newRejectHandler(iq, dialect, label, limit)
+	defer rejects.close()
+
+	builder := newBatchBuilder(table)
+	flush := func() error {
+		if builder.numRows == 0 {
+			return nil
+		}
+		if err := writer.write(builder.build()); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(int64(rowCount))
+		}
+		return nil
+	}
+
+	for {
+		values, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *rowError
+		if errors.As(err, &rowErr) {
+			if err := rejects.reject(rowErr); err != nil {
+				return rowCount, err
+			}
+			continue
+		}
+		if err != nil {
+			return rowCount, err
+		}
+
+		builder.appendRow(values)
+		rowCount += 1
+
+		if builder.numRows == deserializer.BatchSize {
+			if err := flush(); err != nil {
+				return rowCount, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return rowCount, err
+	}
+
+	return rowCount, rejects.close()
+}
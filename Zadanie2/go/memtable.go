@@ -0,0 +1,241 @@
+package openapi
+
+import (
+	"Zadanie2/deserializer"
+	"Zadanie2/metastore"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// memtable buffers rows inserted into a table until there are enough of them
+// for a whole batch, so that small inserts do not each append a tiny batch and
+// rewrite the footer of every column file. The buffered rows are logged in the
+// WAL and replayed into the memtable after a restart.
+//
+// The rows of a memtable are changed only under the write lock of its table,
+// so readers holding the read lock may use them; the memtables map and the
+// fields read by the background flusher are guarded by memMu as well.
+type memtable struct {
+	rows    [][]any
+	inserts []int64   // WAL insert records holding the rows
+	since   time.Time // when the oldest row was buffered
+}
+
+// tableMemtable returns the memtable of a table, nil if it has no buffered
+// rows.
+func (sched *QueryScheduler) tableMemtable(table *metastore.Table) *memtable {
+	sched.memMu.Lock()
+	defer sched.memMu.Unlock()
+	return sched.memtables[table.ID]
+}
+
+// bufferRows logs rows inserted into the table and adds them to its memtable,
+// which is flushed once it holds a whole batch. The caller holds the write
+// lock of the table.
+func (sched *QueryScheduler) bufferRows(table *metastore.Table, rows [][]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	// a memtable whose flush failed when it filled up is flushed before more
+	// rows are buffered, so that it does not grow without bound
+	if mt := sched.tableMemtable(table); mt != nil && len(mt.rows) >= deserializer.BatchSize {
+		if err := sched.flushMemtable(table); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	id, err := sched.wal.LogInsert(table.ID, data)
+	if err != nil {
+		return fmt.Errorf("failed to log inserted rows: %w", err)
+	}
+	sched.addToMemtable(table, rows, id)
+	return nil
+}
+
+// addToMemtable buffers rows held by the WAL insert record insert. A failed
+// flush of a full memtable is only logged: the rows are already durable, and
+// the flusher or the next insert, which fails until it succeeds, tries again.
+func (sched *QueryScheduler) addToMemtable(table *metastore.Table, rows [][]any, insert int64) {
+	sched.memMu.Lock()
+	mt := sched.memtables[table.ID]
+	if mt == nil {
+		mt = &memtable{since: time.Now()}
+		sched.memtables[table.ID] = mt
+	}
+	mt.rows = append(mt.rows, rows...)
+	mt.inserts = append(mt.inserts, insert)
+	full := len(mt.rows) >= deserializer.BatchSize
+	sched.memMu.Unlock()
+
+	if full {
+		if err := sched.flushMemtable(table); err != nil {
+			log.Printf("failed to flush rows inserted into table %s: %v", table.Name, err)
+		}
+	}
+}
+
+// flushMemtable writes the buffered rows of the table to its files. Like a
+// load, the batches are staged first and published at once; the commit of the
+// publication marks the insert records as flushed. The caller holds the write
+// lock of the table.
+func (sched *QueryScheduler) flushMemtable(table *metastore.Table) error {
+	mt := sched.tableMemtable(table)
+	if mt == nil {
+		return nil
+	}
+
+	stagedPath := deserializer.StagingPath(sched.dataDir, "memtable-"+table.ID)
+	defer os.RemoveAll(stagedPath)
+
+	if err := sched.stageRows(table, stagedPath, mt.rows); err != nil {
+		return fmt.Errorf("failed to flush inserted rows: %w", err)
+	}
+	if err := deserializer.PublishInserts(sched.wal, filepath.Join(sched.dataDir, table.Name), stagedPath, mt.inserts); err != nil {
+		return fmt.Errorf("failed to flush inserted rows: %w", err)
+	}
+
+	sched.memMu.Lock()
+	delete(sched.memtables, table.ID)
+	sched.memMu.Unlock()
+	return nil
+}
+
+// dropMemtable discards the buffered rows of a dropped table. Only the first
+// call for a table discards its inserts.
+func (sched *QueryScheduler) dropMemtable(tableID string) error {
+	sched.memMu.Lock()
+	mt := sched.memtables[tableID]
+	delete(sched.memtables, tableID)
+	sched.memMu.Unlock()
+
+	if mt == nil {
+		return nil
+	}
+	return sched.wal.DiscardInserts(mt.inserts)
+}
+
+// memtableBatches returns the buffered rows of the table as batches, to be
+// read after the batches of the table files. The caller holds the read lock
+// of the table.
+func (sched *QueryScheduler) memtableBatches(table *metastore.Table) []*deserializer.Batch {
+	mt := sched.tableMemtable(table)
+	if mt == nil {
+		return nil
+	}
+	var batches []*deserializer.Batch
+	builder := newBatchBuilder(table)
+	for _, values := range mt.rows {
+		builder.appendRow(values)
+		if builder.numRows == deserializer.BatchSize {
+			batches = append(batches, builder.build())
+		}
+	}
+	if builder.numRows > 0 {
+		batches = append(batches, builder.build())
+	}
+	return batches
+}
+
+// flushOldMemtables periodically flushes memtables whose oldest row has been
+// buffered for longer than the flush interval.
+func (sched *QueryScheduler) flushOldMemtables() {
+	defer sched.wg.Done()
+
+	ticker := time.NewTicker(sched.flushInterval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			sched.flushMemtables(time.Now().Add(-sched.flushInterval))
+		case <-sched.stopChan:
+			return
+		}
+	}
+}
+
+// flushMemtables flushes every memtable whose oldest row was buffered before
+// the given time; a zero time flushes all of them.
+func (sched *QueryScheduler) flushMemtables(before time.Time) {
+	var tableIDs []string
+	sched.memMu.Lock()
+	for tableID, mt := range sched.memtables {
+		if before.IsZero() || mt.since.Before(before) {
+			tableIDs = append(tableIDs, tableID)
+		}
+	}
+	sched.memMu.Unlock()
+
+	for _, tableID := range tableIDs {
+		table, err := sched.ms.GetTableById(tableID)
+		if err != nil {
+			// dropped meanwhile; the delete discards the rows too, whichever
+			// of the two takes the memtable first releases its inserts
+			if err := sched.dropMemtable(tableID); err != nil {
+				log.Printf("failed to discard rows inserted into dropped table %s: %v", tableID, err)
+			}
+			continue
+		}
+		table.AcquireWrite()
+		if err := sched.flushMemtable(table); err != nil {
+			log.Printf("failed to flush rows inserted into table %s: %v", table.Name, err)
+		}
+		table.ReleaseWrite()
+	}
+}
+
+// restoreMemtables puts rows which were inserted but not flushed before the
+// server stopped back into the memtables of their tables. Rows of tables
+// which no longer exist, or do not fit their table anymore, are discarded.
+func (sched *QueryScheduler) restoreMemtables(pending []deserializer.PendingInsert) {
+	for _, insert := range pending {
+		table, err := sched.ms.GetTableById(insert.Table)
+		if err == nil {
+			var rows [][]any
+			rows, err = decodeBufferedRows(table, insert.Rows)
+			if err == nil {
+				table.AcquireWrite()
+				sched.addToMemtable(table, rows, insert.ID)
+				table.ReleaseWrite()
+				continue
+			}
+		}
+		log.Printf("discarding %d bytes of rows inserted into table %s: %v", len(insert.Rows), insert.Table, err)
+		if err := sched.wal.DiscardInserts([]int64{insert.ID}); err != nil {
+			log.Fatalf("failed to discard inserted rows: %v", err)
+		}
+	}
+}
+
+// decodeBufferedRows converts rows logged by bufferRows back to table values.
+func decodeBufferedRows(table *metastore.Table, data []byte) ([][]any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var logged [][]any
+	if err := decoder.Decode(&logged); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]any, len(logged))
+	for i, values := range logged {
+		if len(values) != len(table.Columns) {
+			return nil, fmt.Errorf("row has %d values but table has %d columns", len(values), len(table.Columns))
+		}
+		rows[i] = make([]any, len(values))
+		for idx, col := range table.Columns {
+			parsed, err := jsonValue(values[idx], col)
+			if err != nil {
+				return nil, err
+			}
+			rows[i][idx] = parsed
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,175 @@
+package openapi
+
+import (
+	"Zadanie2/deserializer"
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// insertAndWait inserts rows into the table and waits for the insert query.
+func (ts *testServer) insertAndWait(tableID, rows string) {
+	ts.t.Helper()
+	code, body := ts.insertRows(tableID, rows)
+	if code != http.StatusOK {
+		ts.t.Fatalf("insert failed: %d %s", code, body)
+	}
+	iq := ts.wait(strings.Trim(strings.TrimSpace(body), `"`))
+	if iq.GetStatus() != COMPLETED {
+		ts.t.Fatalf("insert ended %s: %s", iq.GetStatus(), problemsOf(iq))
+	}
+}
+
+// bufferedRows returns the number of rows in the memtable of a table.
+func (ts *testServer) bufferedRows(name string) int {
+	ts.t.Helper()
+	table, err := ts.ms.GetTableByName(name)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	mt := ts.service.scheduler.tableMemtable(table)
+	if mt == nil {
+		return 0
+	}
+	return len(mt.rows)
+}
+
+// memtableCount returns the number of tables with buffered rows.
+func (ts *testServer) memtableCount() int {
+	sched := ts.service.scheduler
+	sched.memMu.Lock()
+	defer sched.memMu.Unlock()
+	return len(sched.memtables)
+}
+
+// crashCopy copies the metastore and the data directory of the running
+// server, like they would be left by a crash, and starts a server on them.
+func (ts *testServer) crashCopy() *testServer {
+	ts.t.Helper()
+	crashed := &testServer{t: ts.t, dir: ts.t.TempDir(), cfg: ts.cfg}
+	err := filepath.WalkDir(ts.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(crashed.dir, strings.TrimPrefix(path, ts.dir))
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	crashed.start()
+	ts.t.Cleanup(crashed.stop)
+	return crashed
+}
+
+func TestInsertedRowsAreBufferedUntilStop(t *testing.T) {
+	ts := newTestServer(t)
+	tableID := ts.createTable("t", intColumn("id"))
+	ts.insertAndWait(tableID, `[[1], [2]]`)
+	ts.insertAndWait(tableID, `[[3]]`)
+
+	if n := ts.bufferedRows("t"); n != 3 {
+		t.Errorf("memtable holds %d rows, want 3", n)
+	}
+	// rows loaded by COPY follow the buffered ones
+	ts.mustComplete(QueryQueryDefinition{SourceFilepath: writeTestFile(t, t.TempDir(), "t.csv", "4\n"), DestinationTableName: "t"})
+	if n := ts.bufferedRows("t"); n != 0 {
+		t.Errorf("memtable holds %d rows after COPY, want 0", n)
+	}
+	ts.insertAndWait(tableID, `[[5]]`)
+	want := [][]any{{int64(1)}, {int64(2)}, {int64(3)}, {int64(4)}, {int64(5)}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+
+	ts.restart()
+	if n := ts.bufferedRows("t"); n != 0 {
+		t.Errorf("memtable holds %d rows after restart, want them flushed on stop", n)
+	}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v after restart, want %v", got, want)
+	}
+}
+
+func TestFullMemtableIsFlushed(t *testing.T) {
+	ts := newTestServer(t)
+	tableID := ts.createTable("t", intColumn("id"))
+	rows := make([]string, deserializer.BatchSize)
+	for i := range rows {
+		rows[i] = fmt.Sprintf("[%d]", i)
+	}
+	ts.insertAndWait(tableID, "["+strings.Join(rows, ",")+"]")
+
+	if n := ts.bufferedRows("t"); n != 0 {
+		t.Errorf("memtable holds %d rows, want a full batch flushed", n)
+	}
+	if got := ts.selectRows("t"); len(got) != deserializer.BatchSize {
+		t.Errorf("table holds %d rows, want %d", len(got), deserializer.BatchSize)
+	}
+}
+
+func TestOldMemtableIsFlushed(t *testing.T) {
+	cfg := testConfig()
+	cfg.MemtableFlushInterval = 20 * time.Millisecond
+	ts := newTestServerConfig(t, cfg)
+	tableID := ts.createTable("t", intColumn("id"))
+	ts.insertAndWait(tableID, `[[1]]`)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for ts.bufferedRows("t") != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("memtable was not flushed after the flush interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got, want := ts.selectRows("t"), [][]any{{int64(1)}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+}
+
+func TestBufferedRowsSurviveCrash(t *testing.T) {
+	ts := newTestServer(t)
+	tableID := ts.createTable("t", intColumn("id"))
+	ts.insertAndWait(tableID, `[[1], [2]]`)
+
+	crashed := ts.crashCopy()
+	if n := crashed.bufferedRows("t"); n != 2 {
+		t.Errorf("memtable holds %d rows after the crash, want 2", n)
+	}
+	if got, want := crashed.selectRows("t"), [][]any{{int64(1)}, {int64(2)}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v after the crash, want %v", got, want)
+	}
+}
+
+func TestDropTableDiscardsBufferedRows(t *testing.T) {
+	ts := newTestServer(t)
+	tableID := ts.createTable("t", intColumn("id"))
+	ts.insertAndWait(tableID, `[[1]]`)
+
+	response, err := ts.service.DeleteTable(context.Background(), tableID)
+	if err != nil || response.Code != http.StatusOK {
+		t.Fatalf("failed to drop table: %v %v", response.Body, err)
+	}
+	if mts := ts.memtableCount(); mts != 0 {
+		t.Errorf("%d memtables left after the drop", mts)
+	}
+
+	crashed := ts.crashCopy()
+	if mts := crashed.memtableCount(); mts != 0 {
+		t.Errorf("%d memtables restored after the crash", mts)
+	}
+}
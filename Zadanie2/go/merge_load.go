@@ -0,0 +1,160 @@
+package openapi
+
+import (
+	"Zadanie2/deserializer"
+	"Zadanie2/metastore"
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// mergeKeyIndices returns the table indices of the merge key columns.
+func mergeKeyIndices(table *metastore.Table, names []string) ([]int, error) {
+	keyIdx := make([]int, len(names))
+	for i, name := range names {
+		idx, ok := table.ColumnMapping[name]
+		if !ok {
+			return nil, fmt.Errorf("merge key column '%s' does not exist in table %s", name, table.Name)
+		}
+		keyIdx[i] = idx
+	}
+	return keyIdx, nil
+}
+
+// appendKeyValue encodes a key value so that the encodings of different keys
+// differ. NULL keys are equal to each other.
+func appendKeyValue(buf []byte, val any) []byte {
+	switch v := val.(type) {
+	case nil:
+		return append(buf, 'n')
+	case int64:
+		buf = append(buf, 'i')
+		return strconv.AppendInt(buf, v, 10)
+	default:
+		s := v.(string)
+		buf = append(buf, 's')
+		buf = strconv.AppendInt(buf, int64(len(s)), 10)
+		buf = append(buf, ':')
+		return append(buf, s...)
+	}
+}
+
+// keyedBatches iterates over the rows of the batches in a table directory
+// together with the encoded merge key of every row.
+func keyedBatches(path string, keyIdx []int, visit func(values []any, key string) error) error {
+	des, err := deserializer.NewBatchDeserializer(path)
+	if err != nil {
+		return fmt.Errorf("failed to create deserializer: %w", err)
+	}
+	numBatches, err := des.GetNumBatches()
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var buf []byte
+	for batchIdx := 0; batchIdx < numBatches; batchIdx++ {
+		batch, err := des.ReadBatch(batchIdx)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		columns := make([][]any, batch.NumColumns)
+		for idx := range columns {
+			columns[idx] = batchColumnValues(batch, idx)
+		}
+
+		values := make([]any, batch.NumColumns)
+		for row := 0; row < int(batch.BatchSize); row++ {
+			for idx, col := range columns {
+				values[idx] = col[row]
+			}
+			buf = buf[:0]
+			for _, idx := range keyIdx {
+				buf = appendKeyValue(buf, values[idx])
+			}
+			if err := visit(values, string(buf)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mergeStaged merges the rows of a load staged in stagedPath into the table.
+// The table is rewritten: its rows whose key was not loaded are followed by
+// the loaded rows, of which only the last one of every key is kept. The
+// rewritten files replace the table directory through the WAL, so the table
+// is either merged completely or left unchanged.
+func (sched *QueryScheduler) mergeStaged(iq *internalQuery, table *metastore.Table, stagedPath string, keyIdx []int) error {
+	// position of the last loaded row of every key
+	latest := make(map[string]int)
+	pos := 0
+	err := keyedBatches(stagedPath, keyIdx, func(values []any, key string) error {
+		latest[key] = pos
+		pos++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	mergedPath := filepath.Join(stagedPath, "merged")
+	serialize, err := deserializer.NewSerializer(mergedPath, deserializer.BatchSize, int32(len(table.Columns)))
+	if err != nil {
+		return fmt.Errorf("failed to create serializer: %w", err)
+	}
+	serialize.SetDurability(sched.durability)
+
+	builder := newBatchBuilder(table)
+	numBatches := 0
+	flush := func() error {
+		if err := iq.checkCancelled(); err != nil {
+			return err
+		}
+		if err := serialize.WriteBatch(numBatches, builder.build()); err != nil {
+			return fmt.Errorf("failed to write batch file: %w", err)
+		}
+		numBatches++
+		return nil
+	}
+	appendRow := func(values []any) error {
+		builder.appendRow(values)
+		if builder.numRows == deserializer.BatchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	tablePath := filepath.Join(sched.dataDir, table.Name)
+	err = keyedBatches(tablePath, keyIdx, func(values []any, key string) error {
+		if _, replaced := latest[key]; replaced {
+			return nil
+		}
+		return appendRow(values)
+	})
+	if err != nil {
+		return err
+	}
+
+	pos = 0
+	err = keyedBatches(stagedPath, keyIdx, func(values []any, key string) error {
+		last := latest[key] == pos
+		pos++
+		if !last {
+			return nil
+		}
+		return appendRow(values)
+	})
+	if err != nil {
+		return err
+	}
+	if builder.numRows > 0 {
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+
+	if err := iq.checkCancelled(); err != nil {
+		return err
+	}
+	return deserializer.ReplaceTable(sched.wal, tablePath, mergedPath, filepath.Join(stagedPath, "replaced"))
+}
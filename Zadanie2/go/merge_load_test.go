@@ -0,0 +1,69 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeLoadReplacesRowsByKey(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"), stringColumn("name"))
+	dir := t.TempDir()
+	ts.mustComplete(QueryQueryDefinition{SourceFilepath: writeTestFile(t, dir, "a.csv", "1,a\n2,b\n3,c\n"), DestinationTableName: "t"})
+
+	// of the loaded rows with key 4 the last one is kept
+	src := writeTestFile(t, dir, "b.csv", "2,B\n4,d\n4,D\n")
+	ts.mustComplete(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", MergeKeyColumns: []string{"id"}})
+
+	want := [][]any{{int64(1), "a"}, {int64(3), "c"}, {int64(2), "B"}, {int64(4), "D"}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+
+	ts.restart()
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v after restart, want %v", got, want)
+	}
+}
+
+func TestMergeLoadWithCompositeNullableKey(t *testing.T) {
+	ts := newTestServer(t)
+	region := stringColumn("region")
+	region.Nullable = true
+	ts.createTable("t", region, intColumn("id"), intColumn("value"))
+	dir := t.TempDir()
+	load := func(content string) {
+		ts.mustComplete(QueryQueryDefinition{
+			SourceFilepath:       writeTestFile(t, dir, "t.csv", content),
+			DestinationTableName: "t",
+			NullMarker:           `\N`,
+			MergeKeyColumns:      []string{"region", "id"},
+		})
+	}
+	load("eu,1,10\nus,1,20\n\\N,1,30\n")
+	load("us,1,21\n\\N,1,31\neu,2,40\n")
+
+	want := [][]any{{"eu", int64(1), int64(10)}, {"us", int64(1), int64(21)}, {nil, int64(1), int64(31)}, {"eu", int64(2), int64(40)}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+}
+
+func TestFailedMergeLoadKeepsTable(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	dir := t.TempDir()
+	ts.mustComplete(QueryQueryDefinition{SourceFilepath: writeTestFile(t, dir, "a.csv", "1\n2\n"), DestinationTableName: "t"})
+
+	ts.mustFail(QueryQueryDefinition{SourceFilepath: writeTestFile(t, dir, "b.csv", "2\nx\n"), DestinationTableName: "t", MergeKeyColumns: []string{"id"}})
+	problems := ts.mustFail(QueryQueryDefinition{SourceFilepath: writeTestFile(t, dir, "c.csv", "2\n"), DestinationTableName: "t", MergeKeyColumns: []string{"key"}})
+	if !strings.Contains(problems, "merge key column 'key' does not exist") {
+		t.Errorf("problems %q do not mention the missing key column", problems)
+	}
+
+	want := [][]any{{int64(1)}, {int64(2)}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+}
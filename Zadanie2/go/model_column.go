@@ -19,6 +19,12 @@ type Column struct {
 	Name string `json:"name"`
 
 	Type LogicalColumnType `json:"type"`
+
+	// Value used when a COPY or insert does not provide this column (written as in a CSV file)
+	Default *string `json:"default,omitempty"`
+
+	// Whether the column may contain NULL values
+	Nullable bool `json:"nullable,omitempty"`
 }
 
 // AssertColumnRequired checks if the required fields are not zero-ed
@@ -11,12 +11,19 @@
 package openapi
 
 
+import (
+	"errors"
+)
+
 
 
 // ExecuteQueryRequest - Used to submit a new query for execution
 type ExecuteQueryRequest struct {
 
 	QueryDefinition QueryQueryDefinition `json:"queryDefinition"`
+
+	// Maximum execution time of the query in milliseconds, counted from when it starts running. The server maximum applies if it is lower or this is not set.
+	TimeoutMs int64 `json:"timeoutMs,omitempty"`
 }
 
 // AssertExecuteQueryRequestRequired checks if the required fields are not zero-ed
@@ -38,6 +45,9 @@ func AssertExecuteQueryRequestRequired(obj ExecuteQueryRequest) error {
 
 // AssertExecuteQueryRequestConstraints checks if the values respects the defined constraints
 func AssertExecuteQueryRequestConstraints(obj ExecuteQueryRequest) error {
+	if obj.TimeoutMs < 0 {
+		return &ParsingError{Param: "timeoutMs", Err: errors.New(errMsgMinValueConstraint)}
+	}
 	if err := AssertQueryQueryDefinitionConstraints(obj.QueryDefinition); err != nil {
 		return err
 	}
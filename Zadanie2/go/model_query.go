@@ -25,6 +25,12 @@ type Query struct {
 	IsResultAvailable bool `json:"isResultAvailable,omitempty"`
 
 	QueryDefinition QueryQueryDefinition `json:"queryDefinition,omitempty"`
+
+	// Number of rows processed so far (updated while a COPY or COPY TO query is running)
+	RowsProcessed int64 `json:"rowsProcessed,omitempty"`
+
+	// Results of the single files of a COPY query whose sourceFilepath is a directory or a glob pattern
+	Files []CopyFileResult `json:"files,omitempty"`
 }
 
 // AssertQueryRequired checks if the required fields are not zero-ed
@@ -42,6 +48,11 @@ func AssertQueryRequired(obj Query) error {
 	if err := AssertQueryQueryDefinitionRequired(obj.QueryDefinition); err != nil {
 		return err
 	}
+	for _, el := range obj.Files {
+		if err := AssertCopyFileResultRequired(el); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -50,5 +61,10 @@ func AssertQueryConstraints(obj Query) error {
 	if err := AssertQueryQueryDefinitionConstraints(obj.QueryDefinition); err != nil {
 		return err
 	}
+	for _, el := range obj.Files {
+		if err := AssertCopyFileResultConstraints(el); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -17,7 +17,7 @@ type QueryQueryDefinition struct {
 
 	TableName string `json:"tableName,omitempty"`
 
-	// Path to source CSV file (filepath in perspective of running server! NOT client)
+	// Path to source CSV file (filepath in perspective of running server! NOT client). CSV and NDJSON files may be gzip, zstd, bzip2 or LZ4 compressed. A directory or a glob pattern loads all matching files.
 	SourceFilepath string `json:"sourceFilepath,omitempty"`
 
 	DestinationTableName string `json:"destinationTableName,omitempty"`
@@ -27,6 +27,61 @@ type QueryQueryDefinition struct {
 
 	// Whether CSV file contains header row
 	DoesCsvContainHeader bool `json:"doesCsvContainHeader,omitempty"`
+
+	// Field delimiter of the CSV file (single character, default ',')
+	Delimiter string `json:"delimiter,omitempty"`
+
+	// Quote character of the CSV file (single character, default '\"')
+	QuoteChar string `json:"quoteChar,omitempty"`
+
+	// Character escaping the quote character inside quoted fields. By default quotes are escaped by doubling them.
+	EscapeChar string `json:"escapeChar,omitempty"`
+
+	// Field value representing NULL
+	NullMarker string `json:"nullMarker,omitempty"`
+
+	// Number of leading lines of the file to skip (before the header)
+	SkipRows int32 `json:"skipRows,omitempty"`
+
+	// Lines starting with this character are ignored
+	CommentPrefix string `json:"commentPrefix,omitempty"`
+
+	// Whether leading and trailing white space of every field should be removed
+	TrimSpaces bool `json:"trimSpaces,omitempty"`
+
+	// Whether a quote may appear in an unquoted field and a non-doubled quote may appear in a quoted field
+	LazyQuotes bool `json:"lazyQuotes,omitempty"`
+
+	// Maximum number of rows which may be rejected (wrong number of columns or unparsable value) before the load fails, counted over all files of a multi-file load. Problems with rejected rows are available at /error/{queryId}.
+	MaxErrors int32 `json:"maxErrors,omitempty"`
+
+	// Path of the file rejected rows are written to (filepath in perspective of running server! NOT client). Defaults to a file named after the query ID in the ".rejects" directory of the server data directory. Rows are written in the CSV dialect of the load.
+	RejectsFilepath string `json:"rejectsFilepath,omitempty"`
+
+	// Map CSV columns to table columns by the names in the header row (case-insensitive) instead of by position. Requires doesCsvContainHeader. CSV columns without a matching table column are ignored.
+	MapColumnsByHeader bool `json:"mapColumnsByHeader,omitempty"`
+
+	// Explicit mapping from CSV header names to table column names, used with mapColumnsByHeader. Every header name and every table column may appear in one rename only (case-insensitive).
+	ColumnRenames map[string]string `json:"columnRenames,omitempty"`
+
+	// Number of files loaded in parallel when sourceFilepath is a directory or a glob pattern (default 1)
+	ParallelFiles int32 `json:"parallelFiles,omitempty"`
+
+	// Table columns forming the key of a merging load. Loaded rows replace the table rows with the same key and rows with new keys are appended; of loaded rows sharing a key the last one is kept.
+	MergeKeyColumns []string `json:"mergeKeyColumns,omitempty"`
+
+	// Keep following the source file as it grows and append its new complete rows to the table in micro-batches until the query is stopped. Requires a single uncompressed CSV or NDJSON file.
+	Follow bool `json:"follow,omitempty"`
+
+	SourceFormat SourceFormat `json:"sourceFormat,omitempty"`
+
+	// JSON pointers (RFC 6901) of nested fields, by table column name. Used with NDJSON source format; other columns are read from top-level fields of the same name.
+	JsonPaths map[string]string `json:"jsonPaths,omitempty"`
+
+	// Path to destination file of the COPY TO query (filepath in perspective of running server! NOT client). An existing file is overwritten.
+	DestinationFilepath string `json:"destinationFilepath,omitempty"`
+
+	DestinationFormat SourceFormat `json:"destinationFormat,omitempty"`
 }
 
 // AssertQueryQueryDefinitionRequired checks if the required fields are not zero-ed
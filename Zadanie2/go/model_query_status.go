@@ -26,6 +26,7 @@ const (
 	RUNNING QueryStatus = "RUNNING"
 	COMPLETED QueryStatus = "COMPLETED"
 	FAILED QueryStatus = "FAILED"
+	CANCELLED QueryStatus = "CANCELLED"
 )
 
 // AllowedQueryStatusEnumValues is all the allowed values of QueryStatus enum
@@ -35,6 +36,7 @@ var AllowedQueryStatusEnumValues = []QueryStatus{
 	"RUNNING",
 	"COMPLETED",
 	"FAILED",
+	"CANCELLED",
 }
 
 // validQueryStatusEnumValue provides a map of QueryStatuss for fast verification of use input
@@ -44,6 +46,7 @@ var validQueryStatusEnumValues = map[QueryStatus]struct{}{
 	"RUNNING": {},
 	"COMPLETED": {},
 	"FAILED": {},
+	"CANCELLED": {},
 }
 
 // IsValid return true if the value is valid for the enum, false otherwise
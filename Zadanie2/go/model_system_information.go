@@ -27,6 +27,9 @@ type SystemInformation struct {
 
 	// System uptime in seconds
 	Uptime int64 `json:"uptime"`
+
+	// Durability (fsync) mode of the server: none, batch or commit
+	Durability string `json:"durability,omitempty"`
 }
 
 // AssertSystemInformationRequired checks if the required fields are not zero-ed
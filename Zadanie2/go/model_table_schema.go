@@ -16,6 +16,7 @@ package openapi
 // TableSchema - Description of the table in the database
 type TableSchema struct {
 
+	// Name of the table. It cannot be empty, start with '.' or contain any of the characters /\:*?"<>|
 	Name string `json:"name"`
 
 	Columns []Column `json:"columns"`
@@ -0,0 +1,131 @@
+package openapi
+
+import (
+	"Zadanie2/metastore"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// expandSourcePaths resolves the sourceFilepath of a COPY query. An existing
+// regular file is used as is; a directory stands for the regular files in it
+// and any other path is treated as a glob pattern. expanded reports whether
+// the path was a directory or a pattern. Files are returned in name order.
+func expandSourcePaths(path string) (paths []string, expanded bool, err error) {
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && !info.IsDir():
+		return []string{path}, false, nil
+	case err == nil:
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, true, fmt.Errorf("failed to read source directory: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() && isLoadableSource(entry.Name()) {
+				paths = append(paths, filepath.Join(path, entry.Name()))
+			}
+		}
+	case strings.ContainsAny(path, "*?["):
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, true, fmt.Errorf("invalid source pattern: %w", err)
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() && isLoadableSource(match) {
+				paths = append(paths, match)
+			}
+		}
+	default:
+		// let opening the file report the problem
+		return []string{path}, false, nil
+	}
+
+	if len(paths) == 0 {
+		return nil, true, fmt.Errorf("no source files match '%s'", path)
+	}
+	sort.Strings(paths)
+	return paths, true, nil
+}
+
+// isLoadableSource skips hidden files and files written by earlier loads.
+func isLoadableSource(path string) bool {
+	name := filepath.Base(path)
+	return !strings.HasPrefix(name, ".") && !strings.HasSuffix(name, ".rejects")
+}
+
+// loadFiles loads several source files into the table, up to parallelFiles of
+// them at a time. A failing file does not stop the others; the result of every
+// file is reported in the query status and the load fails if any file failed.
+func (sched *QueryScheduler) loadFiles(iq *internalQuery, table *metastore.Table, paths []string, writer *tableWriter, limit *rejectLimit) (int, error) {
+	qd := iq.QueryDefinition
+	if qd.RejectsFilepath != "" && len(paths) > 1 {
+		return 0, fmt.Errorf("rejectsFilepath cannot be used when sourceFilepath matches %d files", len(paths))
+	}
+
+	files := make([]CopyFileResult, len(paths))
+	for i, path := range paths {
+		files[i] = CopyFileResult{Filepath: path, Status: CREATED}
+	}
+	iq.SetFiles(files)
+
+	parallel := int(qd.ParallelFiles)
+	if parallel < 1 {
+		parallel = 1
+	}
+	slots := make(chan struct{}, parallel)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	rowCount, failed, stopped := 0, 0, 0
+	for i, path := range paths {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			iq.UpdateFile(i, func(file *CopyFileResult) { file.Status = RUNNING })
+			rows, err := sched.loadFile(iq, table, path, writer, path, limit, func(rows int64) {
+				iq.UpdateFile(i, func(file *CopyFileResult) { file.RowsProcessed = rows })
+			})
+
+			iq.UpdateFile(i, func(file *CopyFileResult) {
+				if err != nil {
+					file.Status = FAILED
+					file.Error = err.Error()
+				} else {
+					file.Status = COMPLETED
+					file.RowsProcessed = int64(rows)
+				}
+			})
+			if err != nil {
+				iq.AddProblem(MultipleProblemsErrorProblemsInner{Error: err.Error(), Context: fmt.Sprintf("file '%s'", path)})
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			rowCount += rows
+			if err != nil {
+				failed++
+			}
+			if cause := iq.checkCancelled(); err != nil && cause != nil && errors.Is(err, cause) {
+				stopped++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failed > 0 && stopped == failed {
+		// every file was stopped by the cancellation, none failed by itself
+		return rowCount, iq.checkCancelled()
+	}
+	if failed > 0 {
+		return rowCount, fmt.Errorf("%d of %d source files failed to load", failed, len(paths))
+	}
+	return rowCount, nil
+}
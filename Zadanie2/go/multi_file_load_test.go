@@ -0,0 +1,149 @@
+package openapi
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestExpandSourcePaths(t *testing.T) {
+	dir := t.TempDir()
+	a := writeTestFile(t, dir, "a.csv", "1\n")
+	b := writeTestFile(t, dir, "b.csv", "2\n")
+	writeTestFile(t, dir, "c.txt", "3\n")
+	writeTestFile(t, dir, ".hidden.csv", "4\n")
+	writeTestFile(t, dir, "old.rejects", "x\n")
+	if err := os.Mkdir(filepath.Join(dir, "sub.csv"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		paths    []string
+		expanded bool
+	}{
+		{a, []string{a}, false},
+		{filepath.Join(dir, "*.csv"), []string{a, b}, true},
+		{dir, []string{a, b, filepath.Join(dir, "c.txt")}, true},
+		{filepath.Join(dir, "missing.csv"), []string{filepath.Join(dir, "missing.csv")}, false},
+	}
+	for _, test := range tests {
+		paths, expanded, err := expandSourcePaths(test.path)
+		if err != nil {
+			t.Errorf("expandSourcePaths(%s): %v", test.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(paths, test.paths) || expanded != test.expanded {
+			t.Errorf("expandSourcePaths(%s) = %v, %v, want %v, %v", test.path, paths, expanded, test.paths, test.expanded)
+		}
+	}
+
+	if _, _, err := expandSourcePaths(filepath.Join(dir, "*.parquet")); err == nil || !strings.Contains(err.Error(), "no source files match") {
+		t.Errorf("pattern matching nothing: %v", err)
+	}
+}
+
+func TestLoadManyFiles(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	dir := t.TempDir()
+	a := writeTestFile(t, dir, "a.csv", "1\n2\n")
+	b := writeTestFile(t, dir, "b.csv", "3\n")
+	c := writeTestFile(t, dir, "c.csv", "4\n5\n6\n")
+
+	iq := ts.mustComplete(QueryQueryDefinition{SourceFilepath: filepath.Join(dir, "*.csv"), DestinationTableName: "t", ParallelFiles: 2})
+
+	var ids []int64
+	for _, row := range ts.selectRows("t") {
+		ids = append(ids, row[0].(int64))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if want := []int64{1, 2, 3, 4, 5, 6}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("table holds %v, want %v", ids, want)
+	}
+	want := []CopyFileResult{
+		{Filepath: a, Status: COMPLETED, RowsProcessed: 2},
+		{Filepath: b, Status: COMPLETED, RowsProcessed: 1},
+		{Filepath: c, Status: COMPLETED, RowsProcessed: 3},
+	}
+	if files := iq.GetFiles(); !reflect.DeepEqual(files, want) {
+		t.Errorf("files %v, want %v", files, want)
+	}
+}
+
+func TestFailedFileFailsWholeLoad(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.csv", "1\n2\n")
+	bad := writeTestFile(t, dir, "b.csv", "3\nx\n")
+	writeTestFile(t, dir, "c.csv", "4\n")
+
+	iq := ts.run(QueryQueryDefinition{SourceFilepath: dir, DestinationTableName: "t"})
+	if iq.GetStatus() != FAILED {
+		t.Fatalf("query ended %s, want FAILED", iq.GetStatus())
+	}
+	if problems := problemsOf(iq); !strings.Contains(problems, "file '"+bad+"'") {
+		t.Errorf("problems %q do not name the failed file", problems)
+	}
+	for _, file := range iq.GetFiles() {
+		want := COMPLETED
+		if file.Filepath == bad {
+			want = FAILED
+		}
+		if file.Status != want {
+			t.Errorf("file %s ended %s, want %s", file.Filepath, file.Status, want)
+		}
+	}
+	if got := ts.selectRows("t"); len(got) != 0 {
+		t.Errorf("failed load left rows %v", got)
+	}
+}
+
+func TestMaxErrorsCountsRowsOfAllFiles(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	dir := t.TempDir()
+	a := writeTestFile(t, dir, "a.csv", "1\nx\n")
+	b := writeTestFile(t, dir, "b.csv", "y\n2\n")
+
+	problems := ts.mustFail(QueryQueryDefinition{SourceFilepath: dir, DestinationTableName: "t", MaxErrors: 1})
+	if !strings.Contains(problems, "exceeds maxErrors (1)") {
+		t.Errorf("problems %q do not mention maxErrors", problems)
+	}
+
+	iq := ts.mustComplete(QueryQueryDefinition{SourceFilepath: dir, DestinationTableName: "t", MaxErrors: 2})
+	if got, want := ts.selectRows("t"), [][]any{{int64(1)}, {int64(2)}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+	for path, want := range map[string]string{a: "x\n", b: "y\n"} {
+		rejects, err := os.ReadFile(ts.service.scheduler.defaultRejectsPath(iq.ID, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(rejects) != want {
+			t.Errorf("rejects file of %s holds %q, want %q", path, rejects, want)
+		}
+	}
+}
+
+func TestRejectsFilepathNeedsSingleFile(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.csv", "1\n")
+	writeTestFile(t, dir, "b.csv", "2\n")
+
+	problems := ts.mustFail(QueryQueryDefinition{
+		SourceFilepath:       dir,
+		DestinationTableName: "t",
+		MaxErrors:            1,
+		RejectsFilepath:      filepath.Join(t.TempDir(), "bad.csv"),
+	})
+	if !strings.Contains(problems, "matches 2 files") {
+		t.Errorf("problems %q do not mention the matched files", problems)
+	}
+}
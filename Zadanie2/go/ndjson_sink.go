@@ -0,0 +1,61 @@
+package openapi
+
+import (
+	"Zadanie2/deserializer"
+	"Zadanie2/metastore"
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// ndjsonSink writes every table row as a JSON object on its own line. Keys
+// follow the table column order; NULL values are written as null.
+type ndjsonSink struct {
+	writer *bufio.Writer
+	keys   [][]byte // encoded `"name":` prefix of every column
+	buf    []byte
+}
+
+func newNDJSONSink(w io.Writer, table *metastore.Table) (*ndjsonSink, error) {
+	keys := make([][]byte, len(table.Columns))
+	for idx, col := range table.Columns {
+		name, err := json.Marshal(col.Name)
+		if err != nil {
+			return nil, err
+		}
+		keys[idx] = append(name, ':')
+	}
+	return &ndjsonSink{writer: bufio.NewWriter(w), keys: keys}, nil
+}
+
+func (sink *ndjsonSink) writeBatch(batch *deserializer.Batch) error {
+	columns := make([][]interface{}, batch.NumColumns)
+	for idx := range columns {
+		columns[idx] = batchColumnValues(batch, idx)
+	}
+
+	for row := 0; row < int(batch.BatchSize); row++ {
+		buf := append(sink.buf[:0], '{')
+		for idx, col := range columns {
+			if idx > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, sink.keys[idx]...)
+			val, err := json.Marshal(col[row])
+			if err != nil {
+				return err
+			}
+			buf = append(buf, val...)
+		}
+		buf = append(buf, '}', '\n')
+		sink.buf = buf
+		if _, err := sink.writer.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sink *ndjsonSink) close() error {
+	return sink.writer.Flush()
+}
@@ -0,0 +1,207 @@
+package openapi
+
+import (
+	"Zadanie2/metastore"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ndjsonRowSource reads newline-delimited JSON objects. Table columns are
+// read from top-level fields of the same name or from the JSON pointer given
+// in jsonPaths.
+type ndjsonRowSource struct {
+	reader   *bufio.Reader
+	table    *metastore.Table
+	pointers [][]string // reference tokens of the JSON pointer of every table column
+	fill     []any
+	fillable []bool
+	line     int
+}
+
+func (sched *QueryScheduler) newNDJSONRowSource(
+	qd QueryQueryDefinition,
+	table *metastore.Table,
+	r io.Reader,
+) (*ndjsonRowSource, error) {
+	pointers := make([][]string, len(table.Columns))
+	for idx, col := range table.Columns {
+		pointers[idx] = []string{col.Name}
+	}
+	for colName, pointer := range qd.JsonPaths {
+		idx, ok := table.ColumnMapping[colName]
+		if !ok {
+			return nil, fmt.Errorf("jsonPaths refers to unknown column '%s'", colName)
+		}
+		tokens, err := parseJSONPointer(pointer)
+		if err != nil {
+			return nil, err
+		}
+		pointers[idx] = tokens
+	}
+
+	// every column may be absent in a particular object, so defaults are
+	// prepared for all of them
+	fill, missing, err := sched.columnFill(table, map[int]int{})
+	if err != nil {
+		return nil, err
+	}
+	fillable := make([]bool, len(table.Columns))
+	for idx := range fillable {
+		fillable[idx] = true
+	}
+	for _, name := range missing {
+		fillable[table.ColumnMapping[name]] = false
+	}
+
+	return &ndjsonRowSource{
+		reader:   bufio.NewReader(r),
+		table:    table,
+		pointers: pointers,
+		fill:     fill,
+		fillable: fillable,
+	}, nil
+}
+
+func (src *ndjsonRowSource) next() ([]any, error) {
+	for {
+		raw, err := src.reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read NDJSON line: %w", err)
+		}
+		if raw == "" && err == io.EOF {
+			return nil, io.EOF
+		}
+		src.line++
+
+		text := strings.TrimSpace(raw)
+		if text == "" {
+			continue
+		}
+		return src.parseLine(text)
+	}
+}
+
+func (src *ndjsonRowSource) parseLine(text string) ([]any, error) {
+	rowErr := func(column string, err error) error {
+		return &rowError{line: src.line, column: column, raw: text, err: err}
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, rowErr("", fmt.Errorf("invalid JSON: %w", err))
+	}
+	if decoder.More() {
+		return nil, rowErr("", fmt.Errorf("invalid JSON: unexpected data after the object"))
+	}
+	if _, ok := doc.(map[string]any); !ok {
+		return nil, rowErr("", fmt.Errorf("line is not a JSON object"))
+	}
+
+	values := make([]any, len(src.table.Columns))
+	for idx, col := range src.table.Columns {
+		val, found := resolveJSONPointer(doc, src.pointers[idx])
+		if !found {
+			if !src.fillable[idx] {
+				return nil, rowErr(col.Name, fmt.Errorf("missing value for column '%s'", col.Name))
+			}
+			values[idx] = src.fill[idx]
+			continue
+		}
+
+		parsed, err := jsonValue(val, col)
+		if err != nil {
+			return nil, rowErr(col.Name, err)
+		}
+		values[idx] = parsed
+	}
+	return values, nil
+}
+
+// jsonValue converts a decoded JSON value to a value of the column type.
+// Strings holding integers are accepted for int columns; numbers, booleans,
+// objects and arrays are stored as JSON text in string columns.
+func jsonValue(val any, col metastore.Column) (any, error) {
+	if val == nil {
+		if !col.Nullable {
+			return nil, fmt.Errorf("NULL value is not allowed for column '%s'", col.Name)
+		}
+		return nil, nil
+	}
+
+	switch col.Type {
+	case metastore.TypeInt:
+		var text string
+		switch v := val.(type) {
+		case json.Number:
+			text = v.String()
+		case string:
+			text = v
+		default:
+			return nil, fmt.Errorf("cannot parse %v as int for column '%s'", val, col.Name)
+		}
+		parsed, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse '%s' as int for column '%s': %w", text, col.Name, err)
+		}
+		return parsed, nil
+	case metastore.TypeString:
+		switch v := val.(type) {
+		case string:
+			return v, nil
+		case json.Number:
+			return v.String(), nil
+		default:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			return string(encoded), nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown column type %d", col.Type)
+	}
+}
+
+// parseJSONPointer splits a JSON pointer (RFC 6901) into reference tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("JSON pointer '%s' must start with '/'", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func resolveJSONPointer(doc any, tokens []string) (any, bool) {
+	current := doc
+	for _, token := range tokens {
+		switch node := current.(type) {
+		case map[string]any:
+			next, ok := node[token]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []any:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, false
+			}
+			current = node[idx]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
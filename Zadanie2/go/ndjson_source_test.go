@@ -0,0 +1,100 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadNDJSON(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t",
+		intColumn("id"),
+		stringColumn("name"),
+		stringColumn("city"),
+		Column{Name: "tags", Type: VARCHAR, Nullable: true},
+	)
+	src := writeTestFile(t, t.TempDir(), "t.ndjson", `{"id": 1, "name": "a", "address": {"city": "Warsaw"}, "tags": ["x", "y"]}
+
+{"id": "2", "name": 3.5, "address": {"city": "Cracow"}, "tags": null}
+{"id": 3, "name": "c", "address": {"city": "Gdansk"}}
+`)
+
+	ts.mustComplete(QueryQueryDefinition{
+		SourceFilepath:       src,
+		DestinationTableName: "t",
+		SourceFormat:         NDJSON,
+		JsonPaths:            map[string]string{"city": "/address/city"},
+	})
+
+	want := [][]any{
+		{int64(1), "a", "Warsaw", `["x","y"]`},
+		{int64(2), "3.5", "Cracow", nil},
+		{int64(3), "c", "Gdansk", nil},
+	}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+}
+
+func TestLoadNDJSONRejectsBadLines(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"), stringColumn("name"))
+	src := writeTestFile(t, t.TempDir(), "t.ndjson", `{"id": 1, "name": "a"}
+{"id": 2
+[1, 2]
+{"id": "x", "name": "b"}
+{"name": "c"}
+{"id": 6, "name": "f"}
+`)
+
+	iq := ts.mustComplete(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", SourceFormat: NDJSON, MaxErrors: 4})
+
+	want := [][]any{{int64(1), "a"}, {int64(6), "f"}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+	problems := problemsOf(iq)
+	for _, problem := range []string{
+		"invalid JSON",
+		"line is not a JSON object (line 3)",
+		"cannot parse 'x' as int for column 'id'",
+		"missing value for column 'id' (line 5, column 'id')",
+	} {
+		if !strings.Contains(problems, problem) {
+			t.Errorf("problems %q do not contain %q", problems, problem)
+		}
+	}
+}
+
+func TestParseJSONPointer(t *testing.T) {
+	tests := []struct {
+		pointer string
+		want    []string
+	}{
+		{"", []string{}},
+		{"/a", []string{"a"}},
+		{"/a/0/b", []string{"a", "0", "b"}},
+		{"/a~1b/c~0d", []string{"a/b", "c~d"}},
+	}
+	for _, tt := range tests {
+		got, err := parseJSONPointer(tt.pointer)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseJSONPointer(%q) = %q, %v, want %q", tt.pointer, got, err, tt.want)
+		}
+	}
+	if _, err := parseJSONPointer("a"); err == nil {
+		t.Error("pointer without a leading '/' accepted")
+	}
+}
+
+func TestValidateCopyJSONPaths(t *testing.T) {
+	csv := QueryQueryDefinition{JsonPaths: map[string]string{"a": "/a"}}
+	if err := csv.validateCopy(); err == nil {
+		t.Error("jsonPaths accepted with CSV source format")
+	}
+	bad := QueryQueryDefinition{SourceFormat: NDJSON, JsonPaths: map[string]string{"a": "a"}}
+	if err := bad.validateCopy(); err == nil {
+		t.Error("invalid JSON pointer accepted")
+	}
+}
@@ -0,0 +1,274 @@
+package openapi
+
+import (
+	"Zadanie2/metastore"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// csvChunkSize is the approximate size of the pieces a CSV file is split into
+// for parallel parsing.
+const csvChunkSize = 1 << 20
+
+// parallelizable reports whether record boundaries of the dialect can be found
+// without parsing the fields. With lazyQuotes a quote does not necessarily
+// start or end a quoted field, so such files are parsed sequentially.
+func (d csvDialect) parallelizable() bool {
+	return !d.lazyQuotes
+}
+
+// csvSplitter cuts a CSV stream into chunks of whole records. It follows the
+// quoting of the dialect to tell record separators from newlines inside
+// quoted fields; lines starting with the comment prefix are not inspected.
+type csvSplitter struct {
+	r           *bufio.Reader
+	dialect     csvDialect
+	line        int // number of lines returned so far
+	inQuotes    bool
+	inComment   bool
+	escaped     bool
+	atLineStart bool
+}
+
+func newCSVSplitter(r *bufio.Reader, dialect csvDialect) *csvSplitter {
+	return &csvSplitter{r: r, dialect: dialect, line: dialect.skipRows, atLineStart: true}
+}
+
+// next returns a chunk of at least size bytes (unless the input ends) which
+// ends at a record boundary, and the number of its first line in the file.
+// It returns io.EOF when the input is exhausted.
+func (s *csvSplitter) next(size int) ([]byte, int, error) {
+	firstLine := s.line + 1
+	var chunk []byte
+	for {
+		part, err := s.r.ReadSlice('\n')
+		if len(part) > 0 {
+			s.scan(part)
+			chunk = append(chunk, part...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			if len(chunk) == 0 {
+				return nil, firstLine, io.EOF
+			}
+			return chunk, firstLine, nil
+		}
+		if err != nil {
+			return nil, firstLine, err
+		}
+
+		s.line++
+		if len(chunk) >= size && !s.inQuotes {
+			return chunk, firstLine, nil
+		}
+	}
+}
+
+// scan updates the quoting state with a part of a line. Like dialectReader
+// it treats the byte following the escape character inside a quoted field as
+// escaped.
+func (s *csvSplitter) scan(part []byte) {
+	d := s.dialect
+	if s.atLineStart && !s.inQuotes && d.comment != 0 && bytes.HasPrefix(part, []byte(string(d.comment))) {
+		s.inComment = true
+	}
+
+	if !s.inComment {
+		for _, c := range part {
+			switch {
+			case s.escaped:
+				s.escaped = false
+			case d.escape != 0 && c == d.escape && s.inQuotes:
+				s.escaped = true
+			case c == d.quote:
+				s.inQuotes = !s.inQuotes
+			}
+		}
+	}
+
+	s.atLineStart = part[len(part)-1] == '\n'
+	if s.atLineStart {
+		// a comment ends at the first newline whatever it contains
+		s.inComment = false
+	}
+}
+
+// csvChunk is a piece of a CSV file queued for parsing; the parsed rows are
+// delivered on result.
+type csvChunk struct {
+	data      []byte
+	firstLine int
+	result    chan csvChunkResult
+}
+
+type csvChunkResult struct {
+	rows []csvChunkRow
+	err  error // error which stops the load after rows
+}
+
+type csvChunkRow struct {
+	values []any
+	err    error
+}
+
+// parallelCSVRowSource parses a CSV file on the scan pool. The file is read
+// and split into chunks of whole records by a single goroutine; chunks are
+// parsed and converted to table values by pool tasks, so concurrent loads
+// share the pool with scans instead of each starting its own parsers, and
+// handed out in file order, so batches are still written in the order of the
+// file.
+type parallelCSVRowSource struct {
+	layout  *csvLayout
+	pool    *scanPool
+	results chan chan csvChunkResult
+	done    chan struct{}
+	wg      sync.WaitGroup
+	current csvChunkResult
+	pos     int
+}
+
+func (sched *QueryScheduler) newParallelCSVRowSource(
+	qd QueryQueryDefinition,
+	table *metastore.Table,
+	r io.Reader,
+	dialect csvDialect,
+) (*parallelCSVRowSource, error) {
+	br := bufio.NewReader(r)
+	if err := dialect.skipLeadingRows(br); err != nil {
+		return nil, err
+	}
+	splitter := newCSVSplitter(br, dialect)
+
+	var csvHeader []string
+	if qd.DoesCsvContainHeader {
+		// comment and empty lines before the header are taken one by one
+		// until a record is found
+		var data []byte
+		for {
+			part, _, err := splitter.next(0)
+			if err != nil && err != io.EOF {
+				return nil, fmt.Errorf("failed to read CSV header: %w", err)
+			}
+			data = append(data, part...)
+			csvHeader, err = readCSVHeader(dialect.csvReader(bufio.NewReader(bytes.NewReader(data))), dialect)
+			if err == nil || part == nil || !errors.Is(err, io.EOF) {
+				if err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+	}
+
+	layout, err := sched.newCSVLayout(qd, table, csvHeader, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &parallelCSVRowSource{
+		layout:  layout,
+		pool:    sched.scanPool,
+		results: make(chan chan csvChunkResult, 2*sched.scanPool.size), // chunks read ahead of next
+		done:    make(chan struct{}),
+	}
+
+	src.wg.Add(1)
+	go src.split(splitter)
+	return src, nil
+}
+
+// split reads chunks, queues them in file order for next and submits their
+// parsing to the pool. A parse task never waits for other tasks, so it cannot
+// hold up the pool.
+func (src *parallelCSVRowSource) split(splitter *csvSplitter) {
+	defer src.wg.Done()
+	defer close(src.results)
+
+	for {
+		data, firstLine, err := splitter.next(csvChunkSize)
+		result := make(chan csvChunkResult, 1)
+		if err != nil {
+			if err != io.EOF {
+				result <- csvChunkResult{err: fmt.Errorf("failed to read CSV row: %w", err)}
+				select {
+				case src.results <- result:
+				case <-src.done:
+				}
+			}
+			return
+		}
+
+		select {
+		case src.results <- result:
+		case <-src.done:
+			return
+		}
+		chunk := csvChunk{data: data, firstLine: firstLine, result: result}
+		src.pool.submit(func() {
+			// result is buffered, so the task finishes even if next no
+			// longer waits for it
+			chunk.result <- src.parseChunk(chunk)
+		})
+	}
+}
+
+func (src *parallelCSVRowSource) parseChunk(chunk csvChunk) csvChunkResult {
+	reader := src.layout.dialect.csvReader(bufio.NewReader(bytes.NewReader(chunk.data)))
+	reader.FieldsPerRecord = -1
+
+	var result csvChunkResult
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return result
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				parseErr.StartLine += chunk.firstLine - 1
+				parseErr.Line += chunk.firstLine - 1
+			}
+			result.err = fmt.Errorf("failed to read CSV row: %w", err)
+			return result
+		}
+		line, _ := reader.FieldPos(0)
+
+		values, err := src.layout.convert(record, chunk.firstLine+line-1)
+		result.rows = append(result.rows, csvChunkRow{values: values, err: err})
+	}
+}
+
+func (src *parallelCSVRowSource) next() ([]any, error) {
+	for src.pos == len(src.current.rows) {
+		if src.current.err != nil {
+			return nil, src.current.err
+		}
+		result, ok := <-src.results
+		if !ok {
+			return nil, io.EOF
+		}
+		src.current = <-result
+		src.pos = 0
+	}
+
+	row := src.current.rows[src.pos]
+	src.pos++
+	return row.values, row.err
+}
+
+// close stops the splitting goroutine; parse tasks already submitted finish
+// on their own.
+func (src *parallelCSVRowSource) close() {
+	close(src.done)
+	// drain the queued chunks, the splitter closes results when it exits
+	for range src.results {
+	}
+	src.wg.Wait()
+}
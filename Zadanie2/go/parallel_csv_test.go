@@ -0,0 +1,172 @@
+package openapi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type splitChunk struct {
+	data      string
+	firstLine int
+}
+
+// split cuts input into chunks of at least size bytes. The input is read
+// through a small buffer, so that lines are scanned in several parts.
+func split(t *testing.T, query QueryQueryDefinition, input string, size int) []splitChunk {
+	t.Helper()
+	d, err := query.csvDialect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	splitter := newCSVSplitter(bufio.NewReaderSize(strings.NewReader(input), 16), d)
+	var chunks []splitChunk
+	for {
+		data, firstLine, err := splitter.next(size)
+		if err == io.EOF {
+			return chunks
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, splitChunk{string(data), firstLine})
+	}
+}
+
+func TestCSVSplitter(t *testing.T) {
+	tests := []struct {
+		name  string
+		query QueryQueryDefinition
+		input string
+		size  int
+		want  []splitChunk
+	}{
+		{
+			name:  "quoted newlines",
+			input: "a,\"x\ny\"\nb,c\n\"multi\n\nline\",d\n",
+			size:  1,
+			want: []splitChunk{
+				{"a,\"x\ny\"\n", 1},
+				{"b,c\n", 3},
+				{"\"multi\n\nline\",d\n", 4},
+			},
+		},
+		{
+			name:  "quoted newline across chunk size",
+			input: "aaaa,bbbb\n\"cc\ncc\",dd\neeee,ffff\n",
+			size:  12,
+			want: []splitChunk{
+				{"aaaa,bbbb\n\"cc\ncc\",dd\n", 1},
+				{"eeee,ffff\n", 4},
+			},
+		},
+		{
+			name:  "line longer than buffer",
+			input: "\"a very long quoted field\nspanning lines\",x\nshort\n",
+			size:  1,
+			want: []splitChunk{
+				{"\"a very long quoted field\nspanning lines\",x\n", 1},
+				{"short\n", 3},
+			},
+		},
+		{
+			name:  "doubled quotes",
+			input: "\"a\"\"\nb\",c\nd\n",
+			size:  1,
+			want: []splitChunk{
+				{"\"a\"\"\nb\",c\n", 1},
+				{"d\n", 3},
+			},
+		},
+		{
+			name:  "escaped quote",
+			query: QueryQueryDefinition{EscapeChar: `\`},
+			input: "\"a\\\"\nb\",c\n\"d\\\\\"\ne\n",
+			size:  1,
+			want: []splitChunk{
+				{"\"a\\\"\nb\",c\n", 1},
+				{"\"d\\\\\"\n", 3},
+				{"e\n", 4},
+			},
+		},
+		{
+			name:  "custom quote",
+			query: QueryQueryDefinition{QuoteChar: "'"},
+			input: "'a\"\nb',c\n\"d\n",
+			size:  1,
+			want: []splitChunk{
+				{"'a\"\nb',c\n", 1},
+				{"\"d\n", 3},
+			},
+		},
+		{
+			name:  "comment with quote",
+			query: QueryQueryDefinition{CommentPrefix: "#"},
+			input: "# \"unbalanced\na,b\n",
+			size:  1,
+			want: []splitChunk{
+				{"# \"unbalanced\n", 1},
+				{"a,b\n", 2},
+			},
+		},
+		{
+			name:  "skipped rows and missing final newline",
+			query: QueryQueryDefinition{SkipRows: 2},
+			input: "a,b\n\"c\nd\"",
+			size:  1,
+			want: []splitChunk{
+				{"a,b\n", 3},
+				{"\"c\nd\"", 4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := split(t, tt.query, tt.input, tt.size); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParallelLoadKeepsRowOrder(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"), stringColumn("name"))
+
+	// several chunks, with quoted newlines and a bad row in the last one
+	const rows = 200000
+	var b strings.Builder
+	for i := 0; i < rows; i++ {
+		if i%1000 == 0 {
+			fmt.Fprintf(&b, "%d,\"line\nbreak\"\n", i)
+		} else {
+			fmt.Fprintf(&b, "%d,name%d\n", i, i)
+		}
+	}
+	b.WriteString("x,bad\n")
+	src := writeTestFile(t, t.TempDir(), "t.csv", b.String())
+	if b.Len() < 3*csvChunkSize {
+		t.Fatalf("source of %d bytes fits in fewer than 3 chunks", b.Len())
+	}
+
+	iq := ts.mustComplete(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", MaxErrors: 1})
+
+	got := ts.selectRows("t")
+	if len(got) != rows {
+		t.Fatalf("table holds %d rows, want %d", len(got), rows)
+	}
+	for i, row := range got {
+		if row[0] != int64(i) {
+			t.Fatalf("row %d holds id %v", i, row[0])
+		}
+	}
+	// every 1000th row spans two lines
+	line := rows + rows/1000 + 1
+	if problems := problemsOf(iq); !strings.Contains(problems, fmt.Sprintf("(line %d, column 'id')", line)) {
+		t.Errorf("problems %q do not point at line %d", problems, line)
+	}
+}
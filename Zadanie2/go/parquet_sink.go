@@ -0,0 +1,104 @@
+package openapi
+
+import (
+	"Zadanie2/deserializer"
+	"Zadanie2/metastore"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetSink writes table batches into a Parquet file, one row group per
+// batch. Int columns are written as INT64 and string columns as BYTE_ARRAY
+// with the UTF8 annotation; nullable columns are optional.
+type parquetSink struct {
+	writer   *parquet.Writer
+	table    *metastore.Table
+	leaves   []int // leaf column index of every table column
+	optional []bool
+}
+
+func newParquetSink(w io.Writer, table *metastore.Table) (*parquetSink, error) {
+	// a parquet.Group orders its fields by name, so the schema is derived
+	// from a struct type to keep the columns in table order
+	fields := make([]reflect.StructField, len(table.Columns))
+	for idx, col := range table.Columns {
+		tag := col.Name
+		if col.Nullable {
+			tag += ",optional"
+		}
+		fieldType := reflect.TypeOf(int64(0))
+		if col.Type == metastore.TypeString {
+			fieldType = reflect.TypeOf("")
+		}
+		fields[idx] = reflect.StructField{
+			Name: fmt.Sprintf("Column%d", idx),
+			Type: fieldType,
+			Tag:  reflect.StructTag(fmt.Sprintf(`parquet:"%s"`, tag)),
+		}
+	}
+	schema := parquet.NewSchema(table.Name, parquet.SchemaOf(reflect.New(reflect.StructOf(fields)).Elem().Interface()))
+
+	leaves := make([]int, len(table.Columns))
+	optional := make([]bool, len(table.Columns))
+	for idx, col := range table.Columns {
+		leaf, _ := schema.Lookup(col.Name)
+		leaves[idx] = leaf.ColumnIndex
+		optional[idx] = col.Nullable
+	}
+
+	return &parquetSink{
+		writer:   parquet.NewWriter(w, schema),
+		table:    table,
+		leaves:   leaves,
+		optional: optional,
+	}, nil
+}
+
+func (sink *parquetSink) writeBatch(batch *deserializer.Batch) error {
+	numRows := int(batch.BatchSize)
+	rows := make([]parquet.Row, numRows)
+	for i := range rows {
+		rows[i] = make(parquet.Row, len(sink.table.Columns))
+	}
+
+	for idx := range sink.table.Columns {
+		isNull := make(map[int64]bool, len(batch.Nulls[idx]))
+		for _, rowIdx := range batch.Nulls[idx] {
+			isNull[rowIdx] = true
+		}
+
+		data := batch.Data[idx]
+		leaf := sink.leaves[idx]
+		definitionLevel := 0
+		if sink.optional[idx] {
+			definitionLevel = 1
+		}
+
+		for i := 0; i < numRows; i++ {
+			var val parquet.Value
+			switch {
+			case isNull[int64(i)]:
+				val = parquet.NullValue().Level(0, 0, leaf)
+			case batch.ColumnTypes[idx] == deserializer.TypeString:
+				str := batch.String[idx][data[i]:data[i+1]]
+				val = parquet.ByteArrayValue([]byte(str)).Level(0, definitionLevel, leaf)
+			default:
+				val = parquet.Int64Value(data[i]).Level(0, definitionLevel, leaf)
+			}
+			rows[i][leaf] = val
+		}
+	}
+
+	if _, err := sink.writer.WriteRows(rows); err != nil {
+		return err
+	}
+	// every batch becomes a separate row group
+	return sink.writer.Flush()
+}
+
+func (sink *parquetSink) close() error {
+	return sink.writer.Close()
+}
@@ -0,0 +1,63 @@
+package openapi
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestExportParquet(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"), stringColumn("name"), Column{Name: "note", Type: VARCHAR, Nullable: true})
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "t.csv", "1,a,x\n2,b,\\N\n")
+	ts.mustComplete(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", NullMarker: `\N`})
+
+	dst := filepath.Join(dir, "t.parquet")
+	iq := ts.mustComplete(QueryQueryDefinition{TableName: "t", DestinationFilepath: dst, DestinationFormat: PARQUET})
+	if rows := iq.GetRowsProcessed(); rows != 2 {
+		t.Errorf("export processed %d rows, want 2", rows)
+	}
+
+	type exportedRow struct {
+		ID   int64   `parquet:"id"`
+		Name string  `parquet:"name"`
+		Note *string `parquet:"note,optional"`
+	}
+	rows, err := parquet.ReadFile[exportedRow](dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].ID != 1 || rows[0].Name != "a" || rows[0].Note == nil || *rows[0].Note != "x" ||
+		rows[1].ID != 2 || rows[1].Name != "b" || rows[1].Note != nil {
+		t.Errorf("exported rows %+v", rows)
+	}
+
+	file, err := parquet.OpenFile(openTestFile(t, dst))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var columns []string
+	for _, path := range file.Schema().Columns() {
+		columns = append(columns, path[0])
+	}
+	if want := []string{"id", "name", "note"}; !reflect.DeepEqual(columns, want) {
+		t.Errorf("exported columns %v, want %v in table order", columns, want)
+	}
+
+	// the exported file loads back into a table of the same schema
+	ts.createTable("copy", intColumn("id"), stringColumn("name"), Column{Name: "note", Type: VARCHAR, Nullable: true})
+	ts.mustComplete(QueryQueryDefinition{SourceFilepath: dst, DestinationTableName: "copy", SourceFormat: PARQUET})
+	if got, want := ts.selectRows("copy"), ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("reloaded table holds %v, want %v", got, want)
+	}
+}
+
+func TestExportParquetRejectsCSVOptions(t *testing.T) {
+	qd := QueryQueryDefinition{TableName: "t", DestinationFilepath: "t.parquet", DestinationFormat: PARQUET, Delimiter: ";"}
+	if err := qd.validateExport(); err == nil {
+		t.Error("delimiter accepted with Parquet destination format")
+	}
+}
@@ -0,0 +1,213 @@
+package openapi
+
+import (
+	"Zadanie2/metastore"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetReadSize is the number of rows read from a row group at once.
+const parquetReadSize = 1024
+
+// parquetRowSource reads an Apache Parquet file one row group at a time.
+// Top-level columns are matched with table columns by name; INT32 and INT64
+// columns are loaded into int columns and BYTE_ARRAY (UTF8) columns into
+// string columns.
+type parquetRowSource struct {
+	file      *os.File
+	pqFile    *parquet.File
+	table     *metastore.Table
+	leaves    []int // leaf column index for every table column, -1 when absent
+	names     []string
+	fill      []any
+	rowGroup  int
+	rows      parquet.Rows
+	buffer    []parquet.Row
+	buffered  int
+	position  int
+	rowNumber int
+}
+
+func (sched *QueryScheduler) newParquetRowSource(table *metastore.Table, path string) (*parquetRowSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat source file: %w", err)
+	}
+	pqFile, err := parquet.OpenFile(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read Parquet file: %w", err)
+	}
+
+	src := &parquetRowSource{
+		file:   file,
+		pqFile: pqFile,
+		table:  table,
+		buffer: make([]parquet.Row, parquetReadSize),
+	}
+	if err := src.mapColumns(sched); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return src, nil
+}
+
+// mapColumns finds the Parquet column of every table column and checks that
+// its physical type can be stored in the table column.
+func (src *parquetRowSource) mapColumns(sched *QueryScheduler) error {
+	schema := src.pqFile.Schema()
+	src.names = make([]string, len(schema.Columns()))
+	src.leaves = make([]int, len(src.table.Columns))
+	colMapping := make(map[int]int)
+
+	for idx, col := range src.table.Columns {
+		src.leaves[idx] = -1
+		for _, path := range schema.Columns() {
+			if len(path) != 1 || !strings.EqualFold(path[0], col.Name) {
+				continue
+			}
+			leaf, _ := schema.Lookup(path...)
+			if leaf.MaxRepetitionLevel > 0 {
+				return fmt.Errorf("Parquet column '%s' is repeated, which is not supported", path[0])
+			}
+			kind := leaf.Node.Type().Kind()
+			if !parquetKindMatches(kind, col.Type) {
+				return fmt.Errorf("Parquet column '%s' of type %s cannot be loaded into column '%s' of type %s",
+					path[0], kind, col.Name, convertTypeToLogical(col.Type))
+			}
+			src.leaves[idx] = leaf.ColumnIndex
+			src.names[leaf.ColumnIndex] = path[0]
+			colMapping[leaf.ColumnIndex] = idx
+			break
+		}
+	}
+
+	fill, missing, err := sched.columnFill(src.table, colMapping)
+	if err != nil {
+		return err
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("Parquet file does not contain table columns without a default value: %s", strings.Join(missing, ", "))
+	}
+	src.fill = fill
+	return nil
+}
+
+func parquetKindMatches(kind parquet.Kind, colType metastore.ColumnType) bool {
+	switch colType {
+	case metastore.TypeInt:
+		return kind == parquet.Int32 || kind == parquet.Int64
+	case metastore.TypeString:
+		return kind == parquet.ByteArray
+	default:
+		return false
+	}
+}
+
+func (src *parquetRowSource) next() ([]any, error) {
+	for src.position == src.buffered {
+		if err := src.readRows(); err != nil {
+			return nil, err
+		}
+	}
+
+	row := src.buffer[src.position]
+	src.position++
+	src.rowNumber++
+
+	byLeaf := make(map[int]parquet.Value, len(row))
+	for _, val := range row {
+		byLeaf[val.Column()] = val
+	}
+
+	values := make([]any, len(src.table.Columns))
+	for idx, col := range src.table.Columns {
+		leaf := src.leaves[idx]
+		if leaf < 0 {
+			values[idx] = src.fill[idx]
+			continue
+		}
+		val := byLeaf[leaf]
+		switch {
+		case val.IsNull():
+			if !col.Nullable {
+				return nil, src.rowError(row, col.Name, fmt.Errorf("NULL value is not allowed for column '%s'", col.Name))
+			}
+			values[idx] = nil
+		case val.Kind() == parquet.Int32:
+			values[idx] = int64(val.Int32())
+		case val.Kind() == parquet.Int64:
+			values[idx] = val.Int64()
+		default:
+			values[idx] = string(val.ByteArray())
+		}
+	}
+	return values, nil
+}
+
+// readRows fills the buffer from the current row group, moving on to the next
+// row group when the current one is exhausted.
+func (src *parquetRowSource) readRows() error {
+	if src.rows == nil {
+		groups := src.pqFile.RowGroups()
+		if src.rowGroup == len(groups) {
+			return io.EOF
+		}
+		src.rows = groups[src.rowGroup].Rows()
+		src.rowGroup++
+	}
+
+	n, err := src.rows.ReadRows(src.buffer)
+	src.buffered = n
+	src.position = 0
+	if err == io.EOF {
+		src.rows.Close()
+		src.rows = nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read Parquet row group %d: %w", src.rowGroup-1, err)
+	}
+	return nil
+}
+
+// rowError describes a rejected row as a JSON object of its column values.
+func (src *parquetRowSource) rowError(row parquet.Row, column string, err error) *rowError {
+	fields := make(map[string]any, len(row))
+	for _, val := range row {
+		name := src.names[val.Column()]
+		if name == "" {
+			continue
+		}
+		switch {
+		case val.IsNull():
+			fields[name] = nil
+		case val.Kind() == parquet.ByteArray:
+			fields[name] = string(val.ByteArray())
+		case val.Kind() == parquet.Int32:
+			fields[name] = val.Int32()
+		default:
+			fields[name] = val.Int64()
+		}
+	}
+	raw, _ := json.Marshal(fields)
+	return &rowError{row: src.rowNumber, column: column, raw: string(raw), err: err}
+}
+
+func (src *parquetRowSource) close() error {
+	if src.rows != nil {
+		src.rows.Close()
+		src.rows = nil
+	}
+	return src.file.Close()
+}
@@ -0,0 +1,85 @@
+package openapi
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type parquetTestRow struct {
+	ID    int32   `parquet:"ID"`
+	Name  string  `parquet:"name"`
+	Note  *string `parquet:"note,optional"`
+	Score float64 `parquet:"score"`
+}
+
+func writeParquetFile[T any](t *testing.T, rows []T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "t.parquet")
+	if err := parquet.WriteFile(path, rows); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadParquet(t *testing.T) {
+	ts := newTestServer(t)
+	fallback := "-"
+	ts.createTable("t",
+		intColumn("id"),
+		Column{Name: "note", Type: VARCHAR, Nullable: true},
+		stringColumn("name"),
+		Column{Name: "city", Type: VARCHAR, Default: &fallback},
+	)
+	note := "x"
+	src := writeParquetFile(t, []parquetTestRow{{ID: 1, Name: "a", Note: &note}, {ID: 2, Name: "b"}})
+
+	ts.mustComplete(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", SourceFormat: PARQUET})
+
+	want := [][]any{{int64(1), "x", "a", "-"}, {int64(2), nil, "b", "-"}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+}
+
+func TestLoadParquetRejectsNull(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"), stringColumn("note"))
+	note := "x"
+	src := writeParquetFile(t, []parquetTestRow{{ID: 1, Note: &note}, {ID: 2}})
+
+	iq := ts.mustComplete(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", SourceFormat: PARQUET, MaxErrors: 1})
+
+	want := [][]any{{int64(1), "x"}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+	if problems := problemsOf(iq); !strings.Contains(problems, "NULL value is not allowed for column 'note' (row 2, column 'note')") {
+		t.Errorf("problems %q do not report the NULL value", problems)
+	}
+}
+
+func TestLoadParquetChecksColumnTypes(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"), intColumn("score"))
+	src := writeParquetFile(t, []parquetTestRow{{ID: 1}})
+
+	problems := ts.mustFail(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", SourceFormat: PARQUET})
+	if !strings.Contains(problems, "Parquet column 'score' of type DOUBLE cannot be loaded into column 'score' of type INT64") {
+		t.Errorf("problems %q do not report the type mismatch", problems)
+	}
+}
+
+func TestLoadParquetReportsMissingColumns(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"), stringColumn("city"))
+	src := writeParquetFile(t, []parquetTestRow{{ID: 1}})
+
+	problems := ts.mustFail(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", SourceFormat: PARQUET})
+	if !strings.Contains(problems, "does not contain table columns without a default value: city") {
+		t.Errorf("problems %q do not list the missing column", problems)
+	}
+}
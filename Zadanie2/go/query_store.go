@@ -1,12 +1,22 @@
 package openapi
 
 import (
+	"context"
+	"errors"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+// errQueryCancelled is the cause of the context of a query cancelled by the
+// client.
+var errQueryCancelled = errors.New("query was cancelled")
+
+// errQueryTimeout is the cause of the context of a query which ran longer
+// than its timeout.
+var errQueryTimeout = errors.New("query timed out")
+
 type internalQuery struct {
 	ID              string
 	QueryDefinition QueryQueryDefinition
@@ -14,6 +24,12 @@ type internalQuery struct {
 	// Immutable fields (set at creation, never modified)
 	IsSelect  bool
 	IsDelete  bool
+	IsExport  bool
+	IsUpload  bool // the source file is a temporary copy of an upload
+	IsInsert  bool
+	IsFollow  bool          // the COPY follows its growing source file until stopped
+	TableID   string        // table the rows of an insert are validated against, or a follow job loads into
+	Timeout   time.Duration // requested maximum execution time, zero if not set
 	Submitted time.Time
 
 	// Mutable fields (protected by mu)
@@ -23,9 +39,19 @@ type internalQuery struct {
 	Finished          *time.Time
 	Error             *MultipleProblemsError
 	ResultRows        QueryResultInner
+	RowsProcessed     int64
+	Files             []CopyFileResult
+	insertRows        [][]any // released once the insert is executed
 
-	doneChan chan struct{}
-	mu       sync.RWMutex
+	// ctx is done once the query is cancelled; long-running parts of the
+	// execution check it between batches
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	doneChan   chan struct{}
+	stopFollow chan struct{} // closed to stop a follow job
+	stopOnce   sync.Once
+	mu         sync.RWMutex
 }
 
 // Thread-safe getters
@@ -53,12 +79,82 @@ func (iq *internalQuery) GetError() *MultipleProblemsError {
 	return iq.Error
 }
 
+// requestStop asks a follow job to load the rows appended so far and finish.
+func (iq *internalQuery) requestStop() {
+	iq.stopOnce.Do(func() { close(iq.stopFollow) })
+}
+
+// takeInsertRows returns the rows of an insert and releases them.
+func (iq *internalQuery) takeInsertRows() [][]any {
+	iq.mu.Lock()
+	defer iq.mu.Unlock()
+	rows := iq.insertRows
+	iq.insertRows = nil
+	return rows
+}
+
+func (iq *internalQuery) GetRowsProcessed() int64 {
+	iq.mu.RLock()
+	defer iq.mu.RUnlock()
+	return iq.RowsProcessed
+}
+
+func (iq *internalQuery) GetFiles() []CopyFileResult {
+	iq.mu.RLock()
+	defer iq.mu.RUnlock()
+	if iq.Files == nil {
+		return nil
+	}
+	return append([]CopyFileResult(nil), iq.Files...)
+}
+
+// checkCancelled returns the cause of the cancellation of the query, nil if
+// it may go on.
+func (iq *internalQuery) checkCancelled() error {
+	if iq.ctx.Err() != nil {
+		return context.Cause(iq.ctx)
+	}
+	return nil
+}
+
 // Thread-safe setters
-func (iq *internalQuery) SetRunning(started time.Time) {
+
+// SetRunning marks the query as running; it returns false if the query was
+// cancelled while waiting in the queue.
+func (iq *internalQuery) SetRunning(started time.Time) bool {
 	iq.mu.Lock()
 	defer iq.mu.Unlock()
+	if iq.Status == CANCELLED {
+		return false
+	}
 	iq.Status = RUNNING
 	iq.Started = &started
+	return true
+}
+
+// Cancel asks the query to stop. A query which has not started yet is
+// cancelled at once, a running one when it next checks its context. It
+// returns false if the query has already finished.
+func (iq *internalQuery) Cancel(now time.Time) bool {
+	iq.mu.Lock()
+	defer iq.mu.Unlock()
+	switch iq.Status {
+	case COMPLETED, FAILED, CANCELLED:
+		return false
+	case RUNNING:
+	default:
+		iq.Status = CANCELLED
+		iq.Finished = &now
+	}
+	iq.cancel(errQueryCancelled)
+	return true
+}
+
+func (iq *internalQuery) SetCancelled(finished time.Time) {
+	iq.mu.Lock()
+	defer iq.mu.Unlock()
+	iq.Status = CANCELLED
+	iq.Finished = &finished
 }
 
 func (iq *internalQuery) SetCompleted(finished time.Time, rows QueryResultInner, isResultAvailable bool) {
@@ -70,12 +166,48 @@ func (iq *internalQuery) SetCompleted(finished time.Time, rows QueryResultInner,
 	iq.IsResultAvailable = isResultAvailable
 }
 
+// SetFailed marks the query as failed; problems already reported with
+// AddProblem are kept in front of the problems of err.
 func (iq *internalQuery) SetFailed(finished time.Time, err *MultipleProblemsError) {
 	iq.mu.Lock()
 	defer iq.mu.Unlock()
 	iq.Status = FAILED
 	iq.Finished = &finished
-	iq.Error = err
+	if iq.Error != nil {
+		iq.Error.Problems = append(iq.Error.Problems, err.Problems...)
+	} else {
+		iq.Error = err
+	}
+}
+
+// AddProblem reports a problem which does not (yet) fail the query, e.g. a
+// row rejected during a load.
+func (iq *internalQuery) AddProblem(problem MultipleProblemsErrorProblemsInner) {
+	iq.mu.Lock()
+	defer iq.mu.Unlock()
+	if iq.Error == nil {
+		iq.Error = &MultipleProblemsError{}
+	}
+	iq.Error.Problems = append(iq.Error.Problems, problem)
+}
+
+func (iq *internalQuery) SetRowsProcessed(rows int64) {
+	iq.mu.Lock()
+	defer iq.mu.Unlock()
+	iq.RowsProcessed = rows
+}
+
+func (iq *internalQuery) SetFiles(files []CopyFileResult) {
+	iq.mu.Lock()
+	defer iq.mu.Unlock()
+	iq.Files = files
+}
+
+// UpdateFile applies update to the result of the idx-th source file.
+func (iq *internalQuery) UpdateFile(idx int, update func(file *CopyFileResult)) {
+	iq.mu.Lock()
+	defer iq.mu.Unlock()
+	update(&iq.Files[idx])
 }
 
 func (iq *internalQuery) ClearResult() {
@@ -103,7 +235,7 @@ func (query QueryQueryDefinition) string() string {
 func (iq *internalQuery) string() string {
 	status := iq.GetStatus()
 	return "Query[ID=" + iq.ID + ", Status=" + string(status) + iq.QueryDefinition.string() +
-		" isSelect=" + strconv.FormatBool(iq.IsSelect) + ", isDelete=" + strconv.FormatBool(iq.IsDelete) + "]"
+		" isSelect=" + strconv.FormatBool(iq.IsSelect) + ", isDelete=" + strconv.FormatBool(iq.IsDelete) + ", isExport=" + strconv.FormatBool(iq.IsExport) + ", isInsert=" + strconv.FormatBool(iq.IsInsert) + ", isFollow=" + strconv.FormatBool(iq.IsFollow) + "]"
 }
 
 func newQueryStore() *queryStore {
@@ -111,6 +243,8 @@ func newQueryStore() *queryStore {
 }
 
 func (qs *queryStore) add(q *internalQuery) {
+	q.ctx, q.cancel = context.WithCancelCause(context.Background())
+
 	qs.mu.Lock()
 	defer qs.mu.Unlock()
 	qs.queries[q.ID] = q
@@ -146,5 +280,7 @@ func toPublic(q *internalQuery) Query {
 		Status:            q.GetStatus(),
 		IsResultAvailable: q.GetIsResultAvailable(),
 		QueryDefinition:   q.QueryDefinition,
+		RowsProcessed:     q.GetRowsProcessed(),
+		Files:             q.GetFiles(),
 	}
 }
@@ -0,0 +1,181 @@
+package openapi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// rejectsDir is the directory of the data directory holding the rejects files
+// of loads which do not set rejectsFilepath. Table names cannot start with
+// '.', so it cannot clash with a table directory.
+const rejectsDir = ".rejects"
+
+// rejectLimit counts the rows rejected by a load against maxErrors. All files
+// of a multi-file load share it, so maxErrors limits the whole query and not
+// every file separately.
+type rejectLimit struct {
+	mu        sync.Mutex
+	maxErrors int
+	count     int
+}
+
+// newRejectLimit returns the limit of a load which has already rejected
+// rejected rows, e.g. in earlier micro-batches of a follow job.
+func newRejectLimit(maxErrors int32, rejected int) *rejectLimit {
+	return &rejectLimit{maxErrors: int(maxErrors), count: rejected}
+}
+
+// add counts a rejected row; it fails once more than maxErrors rows have
+// been rejected.
+func (l *rejectLimit) add() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count++
+	if l.count > l.maxErrors {
+		return fmt.Errorf("number of rejected rows exceeds maxErrors (%d)", l.maxErrors)
+	}
+	return nil
+}
+
+func (l *rejectLimit) rejected() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count
+}
+
+// rejectHandler collects rows skipped while loading a source file. Every
+// rejected row is reported as a problem of the query and written to the
+// rejects file (if any); once the rejected rows exceed the limit the load is
+// aborted.
+type rejectHandler struct {
+	iq       *internalQuery
+	limit    *rejectLimit
+	path     string
+	label    string // source file named in problems of a multi-file load
+	dialect  csvDialect
+	file     *os.File
+	writer   *bufio.Writer
+	buf      []byte
+	append   bool  // add to an existing rejects file instead of replacing it
+	mkdir    bool  // create the directory of the default rejects file
+	written  int64 // bytes written to the rejects file
+	deferred bool  // collect problems in problems instead of reporting them
+	problems []MultipleProblemsErrorProblemsInner
+}
+
+func (sched *QueryScheduler) newRejectHandler(iq *internalQuery, dialect csvDialect, label string, limit *rejectLimit) *rejectHandler {
+	h := &rejectHandler{
+		iq:      iq,
+		limit:   limit,
+		path:    iq.QueryDefinition.RejectsFilepath,
+		label:   label,
+		dialect: dialect,
+	}
+	// without maxErrors the first bad row fails the load, so a rejects file
+	// is only written when asked for explicitly
+	if h.path == "" && iq.QueryDefinition.MaxErrors > 0 {
+		h.path = sched.defaultRejectsPath(iq.ID, label)
+		h.mkdir = true
+	}
+	return h
+}
+
+// defaultRejectsPath returns the rejects file of a query in the data
+// directory, which is writable even when the source directory is not. Every
+// file of a multi-file load gets its own, named after its escaped path.
+func (sched *QueryScheduler) defaultRejectsPath(queryID string, label string) string {
+	if label == "" {
+		return filepath.Join(sched.dataDir, rejectsDir, queryID+".rejects")
+	}
+	name := url.PathEscape(strings.TrimPrefix(filepath.Clean(label), "/"))
+	return filepath.Join(sched.dataDir, rejectsDir, queryID, name+".rejects")
+}
+
+// reject records a bad row of the source file. CSV rows are written to the
+// rejects file in the source dialect, rows of other formats as read.
+func (h *rejectHandler) reject(rowErr *rowError) error {
+	limitErr := h.limit.add()
+
+	context := fmt.Sprintf("line %d", rowErr.line)
+	if rowErr.line == 0 {
+		context = fmt.Sprintf("row %d", rowErr.row)
+	}
+	if rowErr.column != "" {
+		context += fmt.Sprintf(", column '%s'", rowErr.column)
+	}
+	if h.label != "" {
+		context = fmt.Sprintf("file '%s', %s", h.label, context)
+	}
+	problem := MultipleProblemsErrorProblemsInner{Error: rowErr.Error(), Context: context}
+	if h.deferred {
+		h.problems = append(h.problems, problem)
+	} else {
+		h.iq.AddProblem(problem)
+	}
+
+	if h.path == "" {
+		return limitErr
+	}
+	if h.writer == nil {
+		if h.mkdir {
+			if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+				return fmt.Errorf("failed to create rejects file: %w", err)
+			}
+		}
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if h.append {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		file, err := os.OpenFile(h.path, flags, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to create rejects file: %w", err)
+		}
+		h.file = file
+		h.writer = bufio.NewWriter(file)
+	}
+
+	if rowErr.record == nil {
+		n, err := io.WriteString(h.writer, strings.TrimRight(rowErr.raw, "\r\n")+"\n")
+		h.written += int64(n)
+		if err != nil {
+			return fmt.Errorf("failed to write rejects file: %w", err)
+		}
+		return limitErr
+	}
+
+	// written in the dialect of the load, so that the rejects file can be
+	// fixed and loaded with the same options
+	row := make([]*string, len(rowErr.record))
+	for i, field := range rowErr.record {
+		value := h.dialect.field(field)
+		row[i] = &value
+	}
+	h.buf = h.dialect.appendRecord(h.buf[:0], row)
+	n, err := h.writer.Write(h.buf)
+	h.written += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write rejects file: %w", err)
+	}
+
+	return limitErr
+}
+
+func (h *rejectHandler) close() error {
+	if h.writer == nil {
+		return nil
+	}
+	writer, file := h.writer, h.file
+	h.writer, h.file = nil, nil
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write rejects file: %w", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,86 @@
+package openapi
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadRejectsBadRows(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"), stringColumn("name"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "1,a\nx,b\n2,c\n3\n4,d\n")
+
+	iq := ts.mustComplete(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", MaxErrors: 2})
+
+	want := [][]any{{int64(1), "a"}, {int64(2), "c"}, {int64(4), "d"}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+	problems := problemsOf(iq)
+	for _, context := range []string{"(line 2, column 'id')", "(line 4)"} {
+		if !strings.Contains(problems, context) {
+			t.Errorf("problems %q do not mention %s", problems, context)
+		}
+	}
+
+	rejects, err := os.ReadFile(filepath.Join(ts.dataDir(), rejectsDir, iq.ID+".rejects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rejects) != "x,b\n3\n" {
+		t.Errorf("rejects file holds %q", rejects)
+	}
+}
+
+func TestLoadFailsAfterMaxErrors(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "1\nx\ny\n2\n")
+
+	problems := ts.mustFail(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", MaxErrors: 1})
+	if !strings.Contains(problems, "exceeds maxErrors (1)") {
+		t.Errorf("problems %q do not mention maxErrors", problems)
+	}
+	if got := ts.selectRows("t"); len(got) != 0 {
+		t.Errorf("failed load left rows %v", got)
+	}
+}
+
+func TestLoadFailsOnFirstBadRowWithoutMaxErrors(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "1\nx\n")
+
+	ts.mustFail(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t"})
+	if _, err := os.Stat(filepath.Join(ts.dataDir(), rejectsDir)); !os.IsNotExist(err) {
+		t.Errorf("rejects directory created without maxErrors: %v", err)
+	}
+}
+
+func TestRejectsFileUsesLoadDialect(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"), stringColumn("name"))
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "t.csv", "1;'a;b'\n'x';'it''s'\n")
+	rejectsPath := filepath.Join(dir, "bad.csv")
+
+	ts.mustComplete(QueryQueryDefinition{
+		SourceFilepath:       src,
+		DestinationTableName: "t",
+		Delimiter:            ";",
+		QuoteChar:            "'",
+		MaxErrors:            1,
+		RejectsFilepath:      rejectsPath,
+	})
+
+	rejects, err := os.ReadFile(rejectsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rejects) != "x;'it''s'\n" {
+		t.Errorf("rejects file holds %q", rejects)
+	}
+}
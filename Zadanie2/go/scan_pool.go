@@ -0,0 +1,85 @@
+package openapi
+
+import (
+	"sync"
+)
+
+// scanPool executes batch-range scan tasks. A single pool is owned by the
+// QueryScheduler and shared by all queries, so concurrent SELECTs do not
+// multiply the number of reading goroutines. It is sized together with the
+// query workers, see Config.MaxThreads.
+type scanPool struct {
+	size     int
+	tasks    chan func()
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newScanPool(size int) *scanPool {
+	if size < 1 {
+		size = 1
+	}
+	return &scanPool{
+		size:     size,
+		tasks:    make(chan func(), size*4),
+		stopChan: make(chan struct{}),
+	}
+}
+
+func (p *scanPool) start() {
+	for i := 0; i < p.size; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+}
+
+func (p *scanPool) stop() {
+	close(p.stopChan)
+	p.wg.Wait()
+}
+
+// submit queues a task. After the pool is stopped tasks run on the caller's
+// goroutine, so a query waiting for its tasks never hangs.
+func (p *scanPool) submit(task func()) {
+	select {
+	case p.tasks <- task:
+	case <-p.stopChan:
+		task()
+	}
+}
+
+func (p *scanPool) worker() {
+	defer p.wg.Done()
+	for {
+		select {
+		case task := <-p.tasks:
+			task()
+		case <-p.stopChan:
+			return
+		}
+	}
+}
+
+type batchRange struct {
+	start int
+	end   int // exclusive
+}
+
+// splitBatchRanges divides numBatches into at most parts contiguous ranges of
+// nearly equal size.
+func splitBatchRanges(numBatches int, parts int) []batchRange {
+	if parts > numBatches {
+		parts = numBatches
+	}
+	ranges := make([]batchRange, 0, parts)
+	start := 0
+	for i := 0; i < parts; i++ {
+		size := numBatches / parts
+		if i < numBatches%parts {
+			size++
+		}
+		ranges = append(ranges, batchRange{start: start, end: start + size})
+		start += size
+	}
+	return ranges
+}
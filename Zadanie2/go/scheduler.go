@@ -4,7 +4,10 @@ import (
 	"Zadanie2/deserializer"
 	"Zadanie2/metastore"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -21,30 +24,70 @@ type QueryScheduler struct {
 	numWorkers int
 	wg         sync.WaitGroup
 	dataDir    string
+	scanPool   *scanPool
+	durability deserializer.Durability
+	wal        *deserializer.WAL
+
+	memMu         sync.Mutex
+	memtables     map[string]*memtable // by table ID
+	flushInterval time.Duration
+
+	maxQueryTime time.Duration // zero for no limit
 }
 
-func NewQueryScheduler(ms *metastore.Metastore, qs *queryStore, numWorkers int, dataDir string) *QueryScheduler {
+// NewQueryScheduler creates a scheduler running cfg.QueryWorkers queries at a
+// time, with the rest of cfg.MaxThreads in the scan pool.
+func NewQueryScheduler(ms *metastore.Metastore, qs *queryStore, dataDir string, cfg Config) *QueryScheduler {
 	return &QueryScheduler{
-		ms:         ms,
-		qs:         qs,
-		workQueue:  make(chan string, 100),
-		stopChan:   make(chan struct{}),
-		numWorkers: numWorkers,
-		dataDir:    dataDir,
+		ms:            ms,
+		qs:            qs,
+		workQueue:     make(chan string, 100),
+		stopChan:      make(chan struct{}),
+		numWorkers:    cfg.QueryWorkers,
+		dataDir:       dataDir,
+		scanPool:      newScanPool(cfg.MaxThreads - cfg.QueryWorkers),
+		durability:    cfg.Durability,
+		memtables:     make(map[string]*memtable),
+		flushInterval: cfg.MemtableFlushInterval,
+		maxQueryTime:  cfg.MaxQueryTime,
 	}
 }
 
 func (sched *QueryScheduler) Start() {
+	// roll back publications torn by a crash before any query can see them
+	wal, pending, err := deserializer.OpenWAL(sched.dataDir, sched.durability)
+	if err != nil {
+		log.Fatalf("failed to recover write-ahead log: %v", err)
+	}
+	sched.wal = wal
+
+	// staged batches of loads interrupted by a shutdown were never published;
+	// this has to follow the replay, which may restore a table from there
+	os.RemoveAll(deserializer.StagingDir(sched.dataDir))
+
+	sched.restoreMemtables(pending)
+	sched.resumeFollowJobs()
+
+	sched.scanPool.start()
 	for i := 0; i < sched.numWorkers; i++ {
 		sched.wg.Add(1)
 		go sched.worker(i)
 	}
+	sched.wg.Add(1)
+	go sched.flushOldMemtables()
 	// log.Printf("Query scheduler started with %d workers", sched.numWorkers)
 }
 
+// Stop shuts the scheduler down like on SIGTERM. It waits for the queries
+// being executed and for follow jobs to finish their current micro-batch, so
+// that no publication is cut in the middle, and then flushes the memtables.
+// Follow jobs keep their checkpoints and are resumed by the next Start.
 func (sched *QueryScheduler) Stop() {
 	close(sched.stopChan)
 	sched.wg.Wait()
+	sched.flushMemtables(time.Time{})
+	sched.scanPool.stop()
+	sched.wal.Close()
 	// log.Println("Query scheduler stopped")
 }
 
@@ -87,11 +130,27 @@ func (sched *QueryScheduler) executeQuery(workerID int, queryID string) {
 			close(iq.doneChan)
 		}
 	}()
+	if iq.IsUpload {
+		// the temporary copy of an upload is not needed whatever the query
+		// ends with, including a cancellation while it was queued
+		defer os.Remove(iq.QueryDefinition.SourceFilepath)
+	}
 	// log.Printf("Worker %d: Executing query %s (SELECT=%v)", workerID, queryID, iq.IsSelect)
 
 	// Update status to RUNNING
 	now := time.Now()
-	iq.SetRunning(now)
+	if !iq.SetRunning(now) {
+		// cancelled while waiting in the queue
+		return
+	}
+
+	// a query running too long is cancelled like by the client, so it
+	// releases its table lock at its next check between batches
+	timeout := sched.queryTimeout(iq)
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() { iq.cancel(errQueryTimeout) })
+		defer timer.Stop()
+	}
 
 	var err error
 	var resultRows QueryResultInner
@@ -100,6 +159,10 @@ func (sched *QueryScheduler) executeQuery(workerID int, queryID string) {
 		err = sched.executeDelete(iq)
 	} else if iq.IsSelect {
 		resultRows, err = sched.executeSelect(iq)
+	} else if iq.IsExport {
+		err = sched.executeExport(iq)
+	} else if iq.IsInsert {
+		err = sched.executeInsert(iq)
 	} else {
 		err = sched.executeLoad(iq)
 	}
@@ -107,7 +170,19 @@ func (sched *QueryScheduler) executeQuery(workerID int, queryID string) {
 	// Update final status
 	finished := time.Now()
 
-	if err != nil {
+	// a query cancelled while it was failing for another reason has failed;
+	// only an error caused by the cancellation makes it CANCELLED
+	cause := iq.checkCancelled()
+	stopped := err != nil && cause != nil && errors.Is(err, cause)
+
+	if stopped && cause == errQueryTimeout {
+		iq.SetFailed(finished, &MultipleProblemsError{
+			Problems: []MultipleProblemsErrorProblemsInner{{Error: fmt.Sprintf("query timed out after %v", timeout)}},
+		})
+	} else if stopped {
+		// whatever the query has changed was rolled back
+		iq.SetCancelled(finished)
+	} else if err != nil {
 		errMsg := err.Error()
 		iq.SetFailed(finished, &MultipleProblemsError{
 			Problems: []MultipleProblemsErrorProblemsInner{{Error: errMsg}},
@@ -119,6 +194,16 @@ func (sched *QueryScheduler) executeQuery(workerID int, queryID string) {
 	}
 }
 
+// queryTimeout returns the maximum execution time of a query: its own
+// timeout, limited by the server maximum.
+func (sched *QueryScheduler) queryTimeout(iq *internalQuery) time.Duration {
+	timeout := iq.Timeout
+	if sched.maxQueryTime > 0 && (timeout == 0 || timeout > sched.maxQueryTime) {
+		timeout = sched.maxQueryTime
+	}
+	return timeout
+}
+
 // executeSelect handles SELECT query execution
 func (sched *QueryScheduler) executeSelect(iq *internalQuery) (QueryResultInner, error) {
 	tableName := iq.QueryDefinition.TableName
@@ -133,7 +218,7 @@ func (sched *QueryScheduler) executeSelect(iq *internalQuery) (QueryResultInner,
 
 	tableDataFiles := table.GetDataFiles()
 
-	rows, err := sched.readTableData(table, tableDataFiles, iq.QueryDefinition)
+	rows, err := sched.readTableData(iq, table, tableDataFiles)
 	if err != nil {
 		return QueryResultInner{}, err
 	}
@@ -141,8 +226,10 @@ func (sched *QueryScheduler) executeSelect(iq *internalQuery) (QueryResultInner,
 	return rows, nil
 }
 
-// readTableData reads data from table files and applies filtering/projection
-func (sched *QueryScheduler) readTableData(table *metastore.Table, dataFiles []string, qd QueryQueryDefinition) (QueryResultInner, error) {
+// readTableData reads data from table files and applies filtering/projection.
+// Batches are split into contiguous ranges which are scanned in parallel on the
+// scan pool; partial results are concatenated in batch order.
+func (sched *QueryScheduler) readTableData(iq *internalQuery, table *metastore.Table, dataFiles []string) (QueryResultInner, error) {
 
 	allRows := QueryResultInner{}
 	allRows.RowCount = int32(0)
@@ -155,47 +242,110 @@ func (sched *QueryScheduler) readTableData(table *metastore.Table, dataFiles []s
 		return allRows, fmt.Errorf("failed to create deserializer: %w", err)
 	}
 
-	ints, stringsMap, err := des.ReadTableData()
+	numBatches, err := des.GetNumBatches()
 	if err != nil {
-		if err.Error() == "no column files found" {
-			return allRows, nil
-		}
-		// log.Println("Error reading table data:", err)
 		return allRows, fmt.Errorf("failed to read file: %w", err)
 	}
+	buffered := sched.memtableBatches(table)
+	if numBatches == 0 && len(buffered) == 0 {
+		return allRows, nil
+	}
+
+	ranges := splitBatchRanges(numBatches, sched.scanPool.size)
+	partials := make([]scanPartial, len(ranges))
 
-	if len(ints) > 0 && len(ints[0]) > 0 {
-		allRows.RowCount = int32(len(ints[0]))
+	var wg sync.WaitGroup
+	for i, r := range ranges {
+		wg.Add(1)
+		sched.scanPool.submit(func() {
+			defer wg.Done()
+			partials[i] = scanBatchRange(iq, des, r)
+		})
 	}
-	allRows.Columns = make([]QueryResultInnerColumnsInner, len(ints))
+	wg.Wait()
 
-	for idx, row := range ints {
-		strCol, ok := stringsMap[idx]
+	for _, part := range partials {
+		if part.err != nil {
+			return QueryResultInner{}, fmt.Errorf("failed to read file: %w", part.err)
+		}
+		if len(allRows.Columns) == 0 {
+			allRows.Columns = make([]QueryResultInnerColumnsInner, len(part.columns))
+		}
+		for idx, col := range part.columns {
+			allRows.Columns[idx] = append(allRows.Columns[idx], col...)
+		}
+		allRows.RowCount += part.rowCount
+	}
 
-		if ok {
-			col := make([]interface{}, len(row)-1)
-			for i := 0; i < len(row)-1; i++ {
-				col[i] = strCol[row[i]:row[i+1]]
-			}
-			allRows.Columns[idx] = col
-		} else {
-			col := make([]interface{}, len(row))
-			for i := 0; i < len(row); i++ {
-				col[i] = row[i]
-			}
-			allRows.Columns[idx] = col
+	// rows buffered in the memtable were inserted after all batches
+	for _, batch := range buffered {
+		if len(allRows.Columns) == 0 {
+			allRows.Columns = make([]QueryResultInnerColumnsInner, batch.NumColumns)
 		}
+		for idx := range allRows.Columns {
+			allRows.Columns[idx] = append(allRows.Columns[idx], batchColumnValues(batch, idx)...)
+		}
+		allRows.RowCount += batch.BatchSize
 	}
 	return allRows, nil
 }
 
+// scanPartial holds the rows of one batch range.
+type scanPartial struct {
+	columns  []QueryResultInnerColumnsInner
+	rowCount int32
+	err      error
+}
+
+func scanBatchRange(iq *internalQuery, des *deserializer.Deserializer, r batchRange) scanPartial {
+	part := scanPartial{}
+	for batchIdx := r.start; batchIdx < r.end; batchIdx++ {
+		if err := iq.checkCancelled(); err != nil {
+			part.err = err
+			return part
+		}
+		batch, err := des.ReadBatch(batchIdx)
+		if err != nil {
+			part.err = err
+			return part
+		}
+		if part.columns == nil {
+			part.columns = make([]QueryResultInnerColumnsInner, batch.NumColumns)
+		}
+		for idx := 0; idx < int(batch.NumColumns); idx++ {
+			part.columns[idx] = append(part.columns[idx], batchColumnValues(batch, idx)...)
+		}
+		part.rowCount += batch.BatchSize
+	}
+	return part
+}
+
+// batchColumnValues converts a single column of a batch into result values;
+// NULL values become nil.
+func batchColumnValues(batch *deserializer.Batch, idx int) []interface{} {
+	row := batch.Data[idx]
+	var col []interface{}
+	if batch.ColumnTypes[idx] == deserializer.TypeString {
+		strCol := batch.String[idx]
+		col = make([]interface{}, len(row)-1)
+		for i := 0; i < len(row)-1; i++ {
+			col[i] = strCol[row[i]:row[i+1]]
+		}
+	} else {
+		col = make([]interface{}, len(row))
+		for i := 0; i < len(row); i++ {
+			col[i] = row[i]
+		}
+	}
+	for _, rowIdx := range batch.Nulls[idx] {
+		col[rowIdx] = nil
+	}
+	return col
+}
+
 func (sched *QueryScheduler) executeLoad(iq *internalQuery) error {
 
 	tableName := iq.QueryDefinition.DestinationTableName
-	csvPath := iq.QueryDefinition.SourceFilepath
-
-	destCols := iq.QueryDefinition.DestinationColumns
-	header := iq.QueryDefinition.DoesCsvContainHeader
 
 	// log.Printf("Executing LOAD into table %s from %s", tableName, csvPath)
 	table, err := sched.ms.GetTableByName(tableName)
@@ -207,10 +357,16 @@ func (sched *QueryScheduler) executeLoad(iq *internalQuery) error {
 	table.AcquireWrite()
 	defer table.ReleaseWrite()
 
+	// rows inserted before the load have to precede the loaded ones, and a
+	// merge has to see them in the table files
+	if err := sched.flushMemtable(table); err != nil {
+		return err
+	}
+
 	// log.Printf("Loading CSV data into table %s from %s", tableName, csvPath)
-	_, err = sched.loadCSVData(table, tableName, csvPath, destCols, header)
+	_, err = sched.loadData(iq, table)
 	if err != nil {
-		return fmt.Errorf("failed to load CSV data: %w", err)
+		return fmt.Errorf("failed to load %s data: %w", iq.QueryDefinition.sourceFormat(), err)
 	}
 
 	// fmt.Printf("CSV data loaded into table %s from %s\n", tableName, csvPath)
@@ -218,125 +374,181 @@ func (sched *QueryScheduler) executeLoad(iq *internalQuery) error {
 	return nil
 }
 
-func (sched *QueryScheduler) loadCSVData(
+// csvRowSource reads rows of a CSV file and maps them onto table columns.
+type csvRowSource struct {
+	reader  *csv.Reader
+	dialect csvDialect
+	layout  *csvLayout
+}
+
+func (sched *QueryScheduler) newCSVRowSource(
+	qd QueryQueryDefinition,
 	table *metastore.Table,
-	tableName string,
-	csvPath string,
-	destCols []string,
-	hasHeader bool,
-) (int, error) {
-	file, err := os.Open(csvPath)
+	r io.Reader,
+	dialect csvDialect,
+) (*csvRowSource, error) {
+	reader, err := dialect.newReader(r)
 	if err != nil {
-		return 0, fmt.Errorf("failed to open CSV file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
+	reader.ReuseRecord = true
+	// the number of fields is checked for every row, so bad rows can be rejected
+	reader.FieldsPerRecord = -1
 
 	var csvHeader []string
-	if hasHeader {
-		csvHeader, err = reader.Read()
+	if qd.DoesCsvContainHeader {
+		csvHeader, err = readCSVHeader(reader, dialect)
 		if err != nil {
-			return 0, fmt.Errorf("failed to read CSV header: %w", err)
+			return nil, err
 		}
 	}
 
-	// log.Printf("Building column mapping for table %s", tableName)
-	colMapping, err := sched.buildColumnMapping(csvHeader, table, destCols, hasHeader)
+	layout, err := sched.newCSVLayout(qd, table, csvHeader, dialect)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	return &csvRowSource{reader: reader, dialect: dialect, layout: layout}, nil
+}
 
-	// log.Println("Column mapping:", colMapping)
-	numCols := len(table.Columns)
-	rowCount := 0
-
-	// log.Printf("Starting to read CSV data for table %s", tableName)
-	records, err := reader.ReadAll()
+func readCSVHeader(reader *csv.Reader, dialect csvDialect) ([]string, error) {
+	record, err := reader.Read()
 	if err != nil {
-		return 0, fmt.Errorf("failed to read CSV row: %w", err)
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
 	}
-
-	if len(records) == 0 {
-		return 0, nil
+	csvHeader := make([]string, len(record))
+	for i, name := range record {
+		csvHeader[i] = dialect.field(name)
 	}
+	return csvHeader, nil
+}
 
-	numCSVCols := len(records[0])
-	if len(destCols) == 0 && numCSVCols != numCols {
-		return 0, fmt.Errorf("CSV has %d columns but table has %d columns", numCSVCols, numCols)
+func (src *csvRowSource) next() ([]any, error) {
+	record, err := src.reader.Read()
+	if err == io.EOF {
+		return nil, err
 	}
-
-	if len(destCols) != 0 && len(destCols) != numCSVCols {
-		return 0, fmt.Errorf("CSV has %d columns but destinationColumns has %d columns", numCSVCols, len(destCols))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV row: %w", err)
 	}
+	line, _ := src.reader.FieldPos(0)
+	line += src.dialect.skipRows
 
-	for rowCount < len(records) {
-		i := 0
-		columnData := make([][]int64, numCols)
-		strings := make([]strings.Builder, numCols)
-		for ; i < deserializer.BatchSize && rowCount < len(records); i += 1 {
-			record := records[rowCount]
+	return src.layout.convert(record, line)
+}
 
-			for csvIdx, strVal := range record {
-				// log.Println("Record", record)
-				tableColIdx, ok := colMapping[csvIdx]
-				if !ok {
-					continue
-				}
+// csvLayout describes how the fields of CSV records map onto table columns.
+type csvLayout struct {
+	sched        *QueryScheduler
+	table        *metastore.Table
+	dialect      csvDialect
+	colMapping   map[int]int
+	fill         []any
+	expectedCols int
+	expectedFrom string
+}
 
-				colType := table.Columns[tableColIdx].Type
+func (sched *QueryScheduler) newCSVLayout(
+	qd QueryQueryDefinition,
+	table *metastore.Table,
+	csvHeader []string,
+	dialect csvDialect,
+) (*csvLayout, error) {
+	destCols := qd.DestinationColumns
 
-				// log.Println("Parsing value", strVal, "as type", colType, " tableColIdx ", tableColIdx)
-				parsedVal, err := sched.parseValue(strVal, colType)
-				if err != nil {
-					return rowCount, fmt.Errorf("failed to parse value '%s' for column '%s': %w", strVal, table.Columns[tableColIdx].Name, err)
-				}
+	// log.Printf("Building column mapping for table %s", tableName)
+	var colMapping map[int]int
+	var err error
+	if qd.MapColumnsByHeader {
+		colMapping, err = sched.buildHeaderColumnMapping(csvHeader, table, qd.ColumnRenames)
+	} else {
+		colMapping, err = sched.buildColumnMapping(csvHeader, table, destCols, qd.DoesCsvContainHeader)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-				if colType == metastore.TypeInt {
-					v := parsedVal.(int64)
-					columnData[tableColIdx] = append(columnData[tableColIdx], v)
-				} else if colType == metastore.TypeString {
-					v := parsedVal.(string)
-					columnData[tableColIdx] = append(columnData[tableColIdx], int64(strings[tableColIdx].Len()))
-					strings[tableColIdx].WriteString(v)
-				}
-			}
-			rowCount += 1
-		}
-		stringsMap := make(map[int]string)
-		columnTypes := make([]byte, numCols)
-		for _, val := range colMapping {
-			colType := table.Columns[val].Type
-			columnTypes[val] = byte(colType)
-
-			if colType == metastore.TypeString {
-				columnData[val] = append(columnData[val], int64(strings[val].Len()))
-				stringsMap[val] = strings[val].String()
-			}
+	fill, missing, err := sched.columnFill(table, colMapping)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) != 0 {
+		if qd.MapColumnsByHeader {
+			return nil, fmt.Errorf("CSV header does not contain table columns without a default value: %s", strings.Join(missing, ", "))
 		}
+		return nil, fmt.Errorf("the provided destinationColumns do not cover table columns without a default value: %s", strings.Join(missing, ", "))
+	}
+
+	// log.Println("Column mapping:", colMapping)
+	layout := &csvLayout{
+		sched:        sched,
+		table:        table,
+		dialect:      dialect,
+		colMapping:   colMapping,
+		fill:         fill,
+		expectedCols: len(table.Columns),
+		expectedFrom: "table",
+	}
+	if qd.MapColumnsByHeader {
+		layout.expectedCols, layout.expectedFrom = len(csvHeader), "CSV header"
+	} else if len(destCols) != 0 {
+		layout.expectedCols, layout.expectedFrom = len(destCols), "destinationColumns"
+	}
+	return layout, nil
+}
 
-		batch := deserializer.Batch{
-			BatchSize:   int32(i),
-			NumColumns:  int32(numCols),
-			ColumnTypes: columnTypes,
-			Data:        columnData,
-			String:      stringsMap,
+// convert turns a CSV record read from the given line into values indexed by
+// table column; a record which cannot be loaded yields a *rowError.
+func (layout *csvLayout) convert(record []string, line int) ([]any, error) {
+	if len(record) != layout.expectedCols {
+		err := fmt.Errorf("CSV row has %d columns but %s has %d columns", len(record), layout.expectedFrom, layout.expectedCols)
+		return nil, &rowError{line: line, record: record, err: err}
+	}
+
+	values, badCol, err := layout.sched.parseRecord(record, layout.table, layout.colMapping, layout.fill, layout.dialect)
+	if err != nil {
+		return nil, &rowError{line: line, column: layout.table.Columns[badCol].Name, record: record, err: err}
+	}
+	return values, nil
+}
+
+// parseRecord converts a CSV record into values indexed by table column;
+// columns not present in the record are taken from fill. On failure it
+// returns the index of the table column which could not be parsed.
+func (sched *QueryScheduler) parseRecord(
+	record []string,
+	table *metastore.Table,
+	colMapping map[int]int,
+	fill []any,
+	dialect csvDialect,
+) ([]any, int, error) {
+	values := make([]any, len(table.Columns))
+	copy(values, fill)
+	for csvIdx, strVal := range record {
+		// log.Println("Record", record)
+		tableColIdx, ok := colMapping[csvIdx]
+		if !ok {
+			continue
 		}
 
-		tablePath := filepath.Join(sched.dataDir, table.Name)
-		serialize, err := deserializer.NewSerializer(tablePath, int32(i), int32(numCols))
-		if err != nil {
-			return rowCount, fmt.Errorf("failed to create serializer: %w", err)
+		colType := table.Columns[tableColIdx].Type
+
+		strVal = dialect.field(strVal)
+		if dialect.isNull(strVal) {
+			if !table.Columns[tableColIdx].Nullable {
+				return nil, tableColIdx, fmt.Errorf("NULL value is not allowed for column '%s'", table.Columns[tableColIdx].Name)
+			}
+			values[tableColIdx] = nil
+			continue
 		}
 
-		err = serialize.WriteBatch(rowCount/deserializer.BatchSize, &batch)
+		// log.Println("Parsing value", strVal, "as type", colType, " tableColIdx ", tableColIdx)
+		parsedVal, err := sched.parseValue(strVal, colType)
 		if err != nil {
-			return 0, fmt.Errorf("failed to write batch file: %w", err)
+			return nil, tableColIdx, fmt.Errorf("failed to parse value '%s' for column '%s': %w", strVal, table.Columns[tableColIdx].Name, err)
 		}
-
+		values[tableColIdx] = parsedVal
 	}
-
-	return rowCount, nil
+	return values, 0, nil
 }
 
 func (sched *QueryScheduler) parseValue(str string, colType metastore.ColumnType) (any, error) {
@@ -372,18 +584,20 @@ func (sched *QueryScheduler) buildColumnMapping(
 
 	mapping := make(map[int]int)
 
-	hit := 0
+	var unknown []string
 	for csvIdx, mapsTo := range destCols {
 		_, ok := table.ColumnMapping[mapsTo]
 		if ok {
 			mapping[csvIdx] = table.ColumnMapping[mapsTo]
-			hit += 1
 			continue
 		}
+		unknown = append(unknown, mapsTo)
 	}
 
-	if hit != len(table.Columns) {
-		return mapping, fmt.Errorf("the provided destinationColumns do not cover all table columns")
+	// a misspelled column would otherwise be silently filled with its
+	// default or NULL
+	if len(unknown) != 0 {
+		return nil, fmt.Errorf("the provided destinationColumns contain columns which do not exist in the table: %s", strings.Join(unknown, ", "))
 	}
 
 	// log.Println("mapping built:", mapping)
@@ -391,6 +605,82 @@ func (sched *QueryScheduler) buildColumnMapping(
 	return mapping, nil
 }
 
+// columnFill returns the values of table columns which are not mapped from
+// the source: the column default or NULL for nullable columns. Names of
+// unmapped columns which have neither are returned in missing.
+func (sched *QueryScheduler) columnFill(table *metastore.Table, colMapping map[int]int) ([]any, []string, error) {
+	mapped := make(map[int]bool, len(colMapping))
+	for _, tableColIdx := range colMapping {
+		mapped[tableColIdx] = true
+	}
+
+	fill := make([]any, len(table.Columns))
+	var missing []string
+	for idx, col := range table.Columns {
+		if mapped[idx] {
+			continue
+		}
+		switch {
+		case col.Default != nil:
+			val, err := sched.parseValue(*col.Default, col.Type)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid default value for column '%s': %w", col.Name, err)
+			}
+			fill[idx] = val
+		case col.Nullable:
+			fill[idx] = nil
+		default:
+			missing = append(missing, col.Name)
+		}
+	}
+	return fill, missing, nil
+}
+
+// CSV column index -> table column index, matched by header names. Names are
+// compared case-insensitively after applying renames (CSV name -> table name);
+// CSV columns which do not match any table column are ignored. Table columns
+// missing from the header are reported by columnFill.
+func (sched *QueryScheduler) buildHeaderColumnMapping(
+	csvHeader []string,
+	table *metastore.Table,
+	renames map[string]string,
+) (map[int]int, error) {
+	lookupColumn := func(name string) (int, bool) {
+		if idx, ok := table.ColumnMapping[name]; ok {
+			return idx, true
+		}
+		for idx, col := range table.Columns {
+			if strings.EqualFold(col.Name, name) {
+				return idx, true
+			}
+		}
+		return 0, false
+	}
+
+	mapping := make(map[int]int)
+	mappedFrom := make(map[int]string)
+	for csvIdx, name := range csvHeader {
+		for from, to := range renames {
+			if strings.EqualFold(from, name) {
+				name = to
+				break
+			}
+		}
+
+		tableColIdx, ok := lookupColumn(name)
+		if !ok {
+			continue
+		}
+		if other, ok := mappedFrom[tableColIdx]; ok {
+			return nil, fmt.Errorf("CSV columns '%s' and '%s' both map to table column '%s'", other, csvHeader[csvIdx], table.Columns[tableColIdx].Name)
+		}
+		mapping[csvIdx] = tableColIdx
+		mappedFrom[tableColIdx] = csvHeader[csvIdx]
+	}
+
+	return mapping, nil
+}
+
 func (sched *QueryScheduler) executeDelete(iq *internalQuery) error {
 
 	tableID := iq.QueryDefinition.TableName
@@ -399,10 +689,18 @@ func (sched *QueryScheduler) executeDelete(iq *internalQuery) error {
 		return err
 	}
 
+	// under the write lock, so that no insert buffers rows and no flush
+	// publishes them while the table and its memtable are dropped
+	table.AcquireWrite()
+	defer table.ReleaseWrite()
+
 	err = sched.ms.DropTable(table.Name)
 	if err != nil {
 		return fmt.Errorf("failed to drop table %s: %w", table.Name, err)
 	}
+	if err := sched.dropMemtable(table.ID); err != nil {
+		return fmt.Errorf("failed to drop table %s: %w", table.Name, err)
+	}
 
 	// log.Printf("Table %s deleted", table.Name)
 
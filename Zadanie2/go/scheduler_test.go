@@ -0,0 +1,168 @@
+package openapi
+
+import (
+	"Zadanie2/deserializer"
+	"context"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadMapsColumnsByHeader(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"), stringColumn("Name"), intColumn("score"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "extra,NAME,points,ID\nx,a,10,1\ny,b,20,2\n")
+
+	ts.mustComplete(QueryQueryDefinition{
+		SourceFilepath:       src,
+		DestinationTableName: "t",
+		DoesCsvContainHeader: true,
+		MapColumnsByHeader:   true,
+		ColumnRenames:        map[string]string{"Points": "score"},
+	})
+
+	want := [][]any{{int64(1), "a", int64(10)}, {int64(2), "b", int64(20)}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+}
+
+func TestLoadByHeaderReportsMissingColumns(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"), stringColumn("name"), intColumn("score"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "id\n1\n")
+
+	problems := ts.mustFail(QueryQueryDefinition{
+		SourceFilepath:       src,
+		DestinationTableName: "t",
+		DoesCsvContainHeader: true,
+		MapColumnsByHeader:   true,
+	})
+	if !strings.Contains(problems, "name, score") {
+		t.Errorf("problems %q do not list the missing columns", problems)
+	}
+}
+
+func TestLoadByHeaderRejectsTwoColumnsMappedToOne(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "id,key\n1,2\n")
+
+	problems := ts.mustFail(QueryQueryDefinition{
+		SourceFilepath:       src,
+		DestinationTableName: "t",
+		DoesCsvContainHeader: true,
+		MapColumnsByHeader:   true,
+		ColumnRenames:        map[string]string{"key": "ID"},
+	})
+	if !strings.Contains(problems, "both map to table column 'id'") {
+		t.Errorf("problems %q do not report the clash", problems)
+	}
+}
+
+func TestLoadFillsDefaultsAndNulls(t *testing.T) {
+	ts := newTestServer(t)
+	unknown := "unknown"
+	ts.createTable("t",
+		intColumn("id"),
+		Column{Name: "name", Type: VARCHAR, Default: &unknown},
+		Column{Name: "note", Type: VARCHAR, Nullable: true},
+		Column{Name: "score", Type: INT64, Nullable: true},
+	)
+	src := writeTestFile(t, t.TempDir(), "t.csv", "1,\\N\n2,7\n")
+
+	ts.mustComplete(QueryQueryDefinition{
+		SourceFilepath:       src,
+		DestinationTableName: "t",
+		DestinationColumns:   []string{"id", "score"},
+		NullMarker:           `\N`,
+	})
+
+	want := [][]any{{int64(1), "unknown", nil, nil}, {int64(2), "unknown", nil, int64(7)}}
+	if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+		t.Errorf("table holds %v, want %v", got, want)
+	}
+}
+
+func TestLoadRejectsNullInNotNullableColumn(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"), stringColumn("name"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "1,NULL\n")
+
+	problems := ts.mustFail(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", NullMarker: "NULL"})
+	if !strings.Contains(problems, "NULL value is not allowed for column 'name'") {
+		t.Errorf("problems %q do not report the NULL value", problems)
+	}
+}
+
+func TestLoadChecksDestinationColumns(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"), stringColumn("name"), Column{Name: "note", Type: VARCHAR, Nullable: true})
+	src := writeTestFile(t, t.TempDir(), "t.csv", "1\n")
+
+	tests := []struct {
+		columns []string
+		err     string
+	}{
+		{columns: []string{"id"}, err: "do not cover table columns without a default value: name"},
+		{columns: []string{"id", "nmae"}, err: "contain columns which do not exist in the table: nmae"},
+	}
+	for _, tt := range tests {
+		problems := ts.mustFail(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", DestinationColumns: tt.columns})
+		if !strings.Contains(problems, tt.err) {
+			t.Errorf("%v: problems %q, want %q", tt.columns, problems, tt.err)
+		}
+	}
+}
+
+func TestTableNameCannotStartWithDot(t *testing.T) {
+	ts := newTestServer(t)
+	for _, name := range []string{".staging", ".rejects", "."} {
+		response, err := ts.service.CreateTable(context.Background(), TableSchema{Name: name, Columns: []Column{intColumn("id")}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("table '%s' created: %d %v", name, response.Code, response.Body)
+		}
+	}
+}
+
+func TestStartRemovesStagedLoads(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	ts.stop()
+
+	// left by a load interrupted by a crash
+	staged := writeTestFile(t, deserializer.StagingPath(ts.dataDir(), "query"), "id.col", "garbage")
+	ts.start()
+
+	if _, err := os.Stat(staged); !os.IsNotExist(err) {
+		t.Errorf("staged files survived start: %v", err)
+	}
+	if got := ts.selectRows("t"); len(got) != 0 {
+		t.Errorf("table holds %v", got)
+	}
+}
+
+func TestSyncedLoadsSurviveRestart(t *testing.T) {
+	for _, durability := range []deserializer.Durability{deserializer.DurabilityBatch, deserializer.DurabilityCommit} {
+		t.Run(string(durability), func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Durability = durability
+			ts := newTestServerConfig(t, cfg)
+			ts.createTable("t", intColumn("id"))
+			dir := t.TempDir()
+			ts.mustComplete(QueryQueryDefinition{SourceFilepath: writeTestFile(t, dir, "a.csv", "1\n2\n"), DestinationTableName: "t"})
+			ts.mustComplete(QueryQueryDefinition{SourceFilepath: writeTestFile(t, dir, "b.csv", "3\n"), DestinationTableName: "t"})
+
+			ts.restart()
+			want := [][]any{{int64(1)}, {int64(2)}, {int64(3)}}
+			if got := ts.selectRows("t"); !reflect.DeepEqual(got, want) {
+				t.Errorf("table holds %v after restart, want %v", got, want)
+			}
+		})
+	}
+}
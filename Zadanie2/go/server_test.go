@@ -0,0 +1,245 @@
+package openapi
+
+import (
+	"Zadanie2/deserializer"
+	"Zadanie2/metastore"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testServer runs the query service on a temporary directory holding the
+// metastore and the data directory, so that tests can stop and restart it.
+type testServer struct {
+	t       *testing.T
+	dir     string
+	cfg     Config
+	ms      *metastore.Metastore
+	service *Proj3APIService
+}
+
+// testConfig does not sync and keeps inserted rows buffered until the server
+// stops, unless a test sets it up otherwise.
+func testConfig() Config {
+	return Config{
+		Durability:            deserializer.DurabilityNone,
+		MemtableFlushInterval: time.Hour,
+		QueryWorkers:          2,
+		MaxThreads:            4,
+	}
+}
+
+func newTestServer(t *testing.T) *testServer {
+	return newTestServerConfig(t, testConfig())
+}
+
+func newTestServerConfig(t *testing.T, cfg Config) *testServer {
+	t.Helper()
+	ts := &testServer{t: t, dir: t.TempDir(), cfg: cfg}
+	ts.start()
+	t.Cleanup(ts.stop)
+	return ts
+}
+
+func (ts *testServer) dataDir() string {
+	return filepath.Join(ts.dir, "data")
+}
+
+func (ts *testServer) start() {
+	ts.t.Helper()
+	ts.ms = metastore.NewMetastore(filepath.Join(ts.dir, "metastore.json"))
+	ts.ms.SetSaveOnChange(true)
+	if err := ts.ms.Load(); err != nil {
+		ts.t.Fatal(err)
+	}
+	qs := newQueryStore()
+	scheduler := NewQueryScheduler(ts.ms, qs, ts.dataDir(), ts.cfg)
+	scheduler.Start()
+	ts.service = &Proj3APIService{ms: ts.ms, qs: qs, si: NewSystemInfo("1.0.1", "1", "test"), scheduler: scheduler}
+}
+
+// stop shuts the server down like on SIGTERM; it may be called again.
+func (ts *testServer) stop() {
+	if ts.service == nil {
+		return
+	}
+	ts.service.Shutdown()
+	ts.service = nil
+}
+
+func (ts *testServer) restart() {
+	ts.t.Helper()
+	ts.stop()
+	ts.start()
+}
+
+// createTable creates a table and returns its ID.
+func (ts *testServer) createTable(name string, columns ...Column) string {
+	ts.t.Helper()
+	response, err := ts.service.CreateTable(context.Background(), TableSchema{Name: name, Columns: columns})
+	if err != nil || response.Code != http.StatusOK {
+		ts.t.Fatalf("failed to create table %s: %v %v", name, response.Body, err)
+	}
+	return response.Body.(string)
+}
+
+// submit submits a query and returns its ID.
+func (ts *testServer) submit(qd QueryQueryDefinition) string {
+	ts.t.Helper()
+	return ts.submitRequest(ExecuteQueryRequest{QueryDefinition: qd})
+}
+
+func (ts *testServer) submitRequest(request ExecuteQueryRequest) string {
+	ts.t.Helper()
+	response, err := ts.service.SubmitQuery(context.Background(), request)
+	if err != nil || response.Code != http.StatusOK {
+		ts.t.Fatalf("failed to submit query: %v %v", response.Body, err)
+	}
+	return response.Body.(string)
+}
+
+// rejected submits a query which has to be rejected and returns the message.
+func (ts *testServer) rejected(qd QueryQueryDefinition) string {
+	ts.t.Helper()
+	response, err := ts.service.SubmitQuery(context.Background(), ExecuteQueryRequest{QueryDefinition: qd})
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	if response.Code != http.StatusBadRequest {
+		ts.t.Fatalf("query was not rejected: %d %v", response.Code, response.Body)
+	}
+	return response.Body.(string)
+}
+
+// wait waits until the query has finished and returns it.
+func (ts *testServer) wait(id string) *internalQuery {
+	ts.t.Helper()
+	iq, ok := ts.service.qs.get(id)
+	if !ok {
+		ts.t.Fatalf("query %s not found", id)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		switch iq.GetStatus() {
+		case COMPLETED, FAILED, CANCELLED:
+			return iq
+		}
+		if time.Now().After(deadline) {
+			ts.t.Fatalf("query %s did not finish, status %s", id, iq.GetStatus())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// run submits a query and waits until it has finished.
+func (ts *testServer) run(qd QueryQueryDefinition) *internalQuery {
+	ts.t.Helper()
+	return ts.wait(ts.submit(qd))
+}
+
+// mustComplete runs a query which has to complete.
+func (ts *testServer) mustComplete(qd QueryQueryDefinition) *internalQuery {
+	ts.t.Helper()
+	iq := ts.run(qd)
+	if iq.GetStatus() != COMPLETED {
+		ts.t.Fatalf("query ended %s: %s", iq.GetStatus(), problemsOf(iq))
+	}
+	return iq
+}
+
+// mustFail runs a query which has to fail and returns its problems.
+func (ts *testServer) mustFail(qd QueryQueryDefinition) string {
+	ts.t.Helper()
+	iq := ts.run(qd)
+	if iq.GetStatus() != FAILED {
+		ts.t.Fatalf("query ended %s, want FAILED", iq.GetStatus())
+	}
+	return problemsOf(iq)
+}
+
+// selectRows returns the rows of a table.
+func (ts *testServer) selectRows(table string) [][]any {
+	ts.t.Helper()
+	return resultRows(ts.mustComplete(QueryQueryDefinition{TableName: table}).GetResultRows())
+}
+
+// problemsOf joins the problems reported by a query.
+func problemsOf(iq *internalQuery) string {
+	var s string
+	if err := iq.GetError(); err != nil {
+		for _, problem := range err.Problems {
+			s += problem.Error
+			if problem.Context != "" {
+				s += " (" + problem.Context + ")"
+			}
+			s += "\n"
+		}
+	}
+	return s
+}
+
+// resultRows turns the columns of a query result into rows.
+func resultRows(result QueryResultInner) [][]any {
+	rows := make([][]any, result.RowCount)
+	for i := range rows {
+		rows[i] = make([]any, len(result.Columns))
+		for col := range result.Columns {
+			rows[i][col] = result.Columns[col][i]
+		}
+	}
+	return rows
+}
+
+// writeTestFile writes a file to dir and returns its path.
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func intColumn(name string) Column {
+	return Column{Name: name, Type: INT64}
+}
+
+func stringColumn(name string) Column {
+	return Column{Name: name, Type: VARCHAR}
+}
+
+// openTestFile opens a file for a reader which needs its size.
+func openTestFile(t *testing.T, path string) (*os.File, int64) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file, info.Size()
+}
+
+// serve sends a request to the HTTP API of the server.
+func (ts *testServer) serve(method, target, contentType string, body io.Reader) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	router := NewRouter(NewProj3APIController(ts.service))
+	request := httptest.NewRequest(method, target, body)
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
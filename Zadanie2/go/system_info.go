@@ -8,6 +8,7 @@ type SystemInfo struct {
 	InterfaceVersion string // JSON: interfaceVersion
 	Version          string // JSON: version
 	Author           string // JSON: author
+	Durability       string // JSON: durability
 	StartedAt        time.Time
 }
 
@@ -0,0 +1,130 @@
+package openapi
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryTimeout(t *testing.T) {
+	tests := []struct {
+		query, server, want time.Duration
+	}{
+		{0, 0, 0},
+		{time.Second, 0, time.Second},
+		{0, time.Minute, time.Minute},
+		{time.Second, time.Minute, time.Second},
+		{time.Hour, time.Minute, time.Minute},
+	}
+	for _, test := range tests {
+		sched := &QueryScheduler{maxQueryTime: test.server}
+		if got := sched.queryTimeout(&internalQuery{Timeout: test.query}); got != test.want {
+			t.Errorf("timeout of %v under server maximum %v is %v, want %v", test.query, test.server, got, test.want)
+		}
+	}
+}
+
+// runBlocked runs a query while a test holds the write lock of the table
+// for the given time.
+func (ts *testServer) runBlocked(table string, request ExecuteQueryRequest, blocked time.Duration) *internalQuery {
+	ts.t.Helper()
+	locked, err := ts.ms.GetTableByName(table)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	locked.AcquireWrite()
+	id := ts.submitRequest(request)
+	ts.waitStatus(id, RUNNING)
+	time.Sleep(blocked)
+	locked.ReleaseWrite()
+	return ts.wait(id)
+}
+
+func TestTimedOutQueryFails(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "1\n")
+
+	iq := ts.runBlocked("t", ExecuteQueryRequest{
+		QueryDefinition: QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t"},
+		TimeoutMs:       20,
+	}, 100*time.Millisecond)
+	if iq.GetStatus() != FAILED {
+		t.Fatalf("query ended %s, want FAILED", iq.GetStatus())
+	}
+	if problems := problemsOf(iq); !strings.Contains(problems, "query timed out after 20ms") {
+		t.Errorf("problems %q do not mention the timeout", problems)
+	}
+	if got := ts.selectRows("t"); len(got) != 0 {
+		t.Errorf("timed out load left rows %v", got)
+	}
+
+	// a query finishing in time is not affected
+	ts.wait(ts.submitRequest(ExecuteQueryRequest{
+		QueryDefinition: QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t"},
+		TimeoutMs:       10000,
+	}))
+	if got := ts.selectRows("t"); len(got) != 1 {
+		t.Errorf("table holds %v, want one row", got)
+	}
+}
+
+func TestServerMaxQueryTime(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxQueryTime = 20 * time.Millisecond
+	ts := newTestServerConfig(t, cfg)
+	ts.createTable("t", intColumn("id"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "1\n")
+
+	// a longer timeout of the query does not lift the server maximum
+	iq := ts.runBlocked("t", ExecuteQueryRequest{
+		QueryDefinition: QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t"},
+		TimeoutMs:       60000,
+	}, 100*time.Millisecond)
+	if problems := problemsOf(iq); iq.GetStatus() != FAILED || !strings.Contains(problems, "query timed out after 20ms") {
+		t.Errorf("query ended %s: %s", iq.GetStatus(), problems)
+	}
+
+	// follow jobs are not limited by the server maximum
+	id := ts.submit(QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", Follow: true})
+	ts.waitRowsProcessed(id, 1)
+	time.Sleep(100 * time.Millisecond)
+	if iq, _ := ts.service.qs.get(id); iq.GetStatus() != RUNNING {
+		t.Errorf("follow job ended %s: %s", iq.GetStatus(), problemsOf(iq))
+	}
+}
+
+func TestFollowRejectsTimeout(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createTable("t", intColumn("id"))
+	src := writeTestFile(t, t.TempDir(), "t.csv", "1\n")
+
+	response, err := ts.service.SubmitQuery(context.Background(), ExecuteQueryRequest{
+		QueryDefinition: QueryQueryDefinition{SourceFilepath: src, DestinationTableName: "t", Follow: true},
+		TimeoutMs:       1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := response.Body.(string); !strings.Contains(body, "timeoutMs cannot be used with follow") {
+		t.Errorf("follow with a timeout answered %d %v", response.Code, response.Body)
+	}
+}
+
+func TestLoadConfigMaxQueryTime(t *testing.T) {
+	t.Setenv("DBMS_MAX_QUERY_TIME", "")
+	if cfg, err := LoadConfig(); err != nil || cfg.MaxQueryTime != 0 {
+		t.Errorf("default maximum query time %v, %v, want no limit", cfg.MaxQueryTime, err)
+	}
+	t.Setenv("DBMS_MAX_QUERY_TIME", "10m")
+	if cfg, err := LoadConfig(); err != nil || cfg.MaxQueryTime != 10*time.Minute {
+		t.Errorf("maximum query time %v, %v, want 10m", cfg.MaxQueryTime, err)
+	}
+	for _, value := range []string{"10", "-1s", "0s"} {
+		t.Setenv("DBMS_MAX_QUERY_TIME", value)
+		if _, err := LoadConfig(); err == nil {
+			t.Errorf("maximum query time %q accepted", value)
+		}
+	}
+}
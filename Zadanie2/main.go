@@ -10,6 +10,7 @@ import (
 	"syscall"
 	"time"
 
+	deserializer "Zadanie2/deserializer"
 	openapi "Zadanie2/go"
 	metastore "Zadanie2/metastore"
 )
@@ -17,8 +18,15 @@ import (
 func main() {
 	log.Printf("Server starting...")
 
+	cfg, err := openapi.LoadConfig()
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
 	// 1) Metastore: load or create empty
 	ms := metastore.NewMetastore("metastore.json")
+	ms.SetSyncOnSave(cfg.Durability != deserializer.DurabilityNone)
+	ms.SetSaveOnChange(cfg.Durability != deserializer.DurabilityNone)
 	if err := ms.Load(); err != nil {
 		log.Fatalf("failed to load metastore: %v", err)
 	}
@@ -26,7 +34,7 @@ func main() {
 		ms.Tables = map[string]*metastore.Table{}
 	}
 
-	Proj3Service := openapi.NewProj3APIService(ms)
+	Proj3Service := openapi.NewProj3APIService(ms, cfg)
 	Proj3Controller := openapi.NewProj3APIController(Proj3Service)
 
 	SchemaAPIService := openapi.NewSchemaAPIService()
@@ -83,10 +91,13 @@ func main() {
 	<-stop
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	// stop accepting queries, then let the scheduler finish the running ones
+	// and flush buffered rows before the metastore is saved
+	_ = srv.Shutdown(ctx)
+	Proj3Service.Shutdown()
 	if err := ms.Save(); err != nil {
 		log.Printf("metastore save error: %v", err)
 	}
 	ms.PrintMetadata(os.Stdout)
-	_ = srv.Shutdown(ctx)
 	log.Println("shutdown complete")
 }
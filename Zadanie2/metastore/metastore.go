@@ -1,12 +1,14 @@
 package metastore
 
 import (
+	"Zadanie2/deserializer"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -22,9 +24,11 @@ const (
 )
 
 type Column struct {
-	Name string     `json:"name"`
-	Path string     `json:"path"`
-	Type ColumnType `json:"type"`
+	Name     string     `json:"name"`
+	Path     string     `json:"path"`
+	Type     ColumnType `json:"type"`
+	Default  *string    `json:"default,omitempty"` // Value used when a load does not provide the column
+	Nullable bool       `json:"nullable,omitempty"`
 }
 
 type DataFile struct {
@@ -36,6 +40,8 @@ type Metastore struct {
 	Tables        map[string]*Table `json:"tables"`
 	mu            sync.RWMutex
 	metastorePath string
+	syncOnSave    bool
+	saveOnChange  bool
 }
 
 func NewMetastore(metastorePath string) *Metastore {
@@ -74,6 +80,11 @@ func validateColumns(columns []Column) error {
 		if col.Type != TypeInt && col.Type != TypeString {
 			return fmt.Errorf("invalid type for %s", col.Name)
 		}
+		if col.Default != nil && col.Type == TypeInt {
+			if _, err := strconv.ParseInt(*col.Default, 10, 64); err != nil {
+				return fmt.Errorf("invalid default value '%s' for %s", *col.Default, col.Name)
+			}
+		}
 	}
 	return nil
 }
@@ -85,6 +96,11 @@ func validateTableName(name string) error {
 	if strings.ContainsAny(name, "/\\:*?\"<>|") {
 		return fmt.Errorf("invalid characters in table name")
 	}
+	// the data directory keeps its own directories (staging, rejects, follow
+	// checkpoints) next to the table directories under hidden names
+	if strings.HasPrefix(name, ".") {
+		return fmt.Errorf("table name cannot start with '.'")
+	}
 	return nil
 }
 
@@ -124,7 +140,14 @@ func (m *Metastore) DebugMetadata() string {
 			sort.Strings(keys)
 			for idx, key := range keys {
 				col := t.Columns[t.ColumnMapping[key]]
-				b.WriteString(fmt.Sprintf("    [%d] %s (type=%s)\n", idx, col.Name, col.Type.String()))
+				b.WriteString(fmt.Sprintf("    [%d] %s (type=%s", idx, col.Name, col.Type.String()))
+				if col.Nullable {
+					b.WriteString(", nullable")
+				}
+				if col.Default != nil {
+					b.WriteString(fmt.Sprintf(", default=%q", *col.Default))
+				}
+				b.WriteString(")\n")
 			}
 		}
 
@@ -172,22 +195,63 @@ func (m *Metastore) Load() error {
 	return nil
 }
 
+// SetSyncOnSave makes Save fsync the metastore file and its directory.
+func (m *Metastore) SetSyncOnSave(sync bool) {
+	m.syncOnSave = sync
+}
+
+// SetSaveOnChange makes CreateTable and DropTable save the metastore before
+// they return, so that tables outlive a crash and not only a clean shutdown.
+func (m *Metastore) SetSaveOnChange(save bool) {
+	m.saveOnChange = save
+}
+
 func (m *Metastore) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.save()
+}
+
+// save writes the metastore file; the caller holds mu.
+func (m *Metastore) save() error {
 	data, err := json.MarshalIndent(m, "", "  ")
 	if err != nil {
 		return fmt.Errorf("serialize error: %w", err)
 	}
 	tmp := m.metastorePath + ".tmp"
-	if err := os.WriteFile(tmp, data, 0644); err != nil {
+	if err := writeFile(tmp, data, m.syncOnSave); err != nil {
+		_ = os.Remove(tmp)
 		return fmt.Errorf("write error: %w", err)
 	}
 	if err := os.Rename(tmp, m.metastorePath); err != nil {
 		_ = os.Remove(tmp)
 		return fmt.Errorf("rename error: %w", err)
 	}
+	if m.syncOnSave {
+		// make the rename durable
+		if err := deserializer.SyncDir(filepath.Dir(m.metastorePath)); err != nil {
+			return fmt.Errorf("sync error: %w", err)
+		}
+	}
 	return nil
 }
 
+// writeFile is os.WriteFile which optionally syncs the file before closing it.
+func writeFile(name string, data []byte, sync bool) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil && sync {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
 func (m *Metastore) CreateTable(name string, columns []Column, dataDir string) (string, error) {
 	if err := validateTableName(name); err != nil {
 		return "", err
@@ -233,6 +297,12 @@ func (m *Metastore) CreateTable(name string, columns []Column, dataDir string) (
 	}
 
 	m.Tables[name] = t
+	if m.saveOnChange {
+		if err := m.save(); err != nil {
+			delete(m.Tables, name)
+			return "", fmt.Errorf("failed to save metastore: %w", err)
+		}
+	}
 	return t.ID, nil
 }
 
@@ -261,6 +331,8 @@ func (m *Metastore) getTable(name string) (*Table, error) {
 	return t, nil
 }
 
+// DropTable removes the table and its data files. The caller holds the write
+// lock of the table.
 func (m *Metastore) DropTable(tableName string) error {
 	m.mu.Lock()
 	table, err := m.getTable(tableName)
@@ -269,12 +341,17 @@ func (m *Metastore) DropTable(tableName string) error {
 		return err
 	}
 
-	table.AcquireWrite()
-	defer table.ReleaseWrite()
 	tableFiles := table.GetDataFiles()
 	// log.Println("Deleting table", tableName, "with files:", tableFiles)
 
 	delete(m.Tables, tableName)
+	if m.saveOnChange {
+		if err := m.save(); err != nil {
+			m.Tables[tableName] = table
+			m.mu.Unlock()
+			return fmt.Errorf("failed to save metastore: %w", err)
+		}
+	}
 	m.mu.Unlock()
 
 	// log.Println("Deleting table2", tableName, "with files:", tableFiles)